@@ -0,0 +1,66 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command diff shows the parameters that differ between two patches, or
+// between the patch slots of two packs.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+
+	"yrh.dev/circuit/pack"
+)
+
+func load(fname string) (*pack.Pack, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single patch is handled as a pack with one slot.
+	if patch, _, err := pack.ParsePatch(data); err == nil {
+		return &pack.Pack{Patches: []*pack.Patch{patch}}, nil
+	}
+
+	p := &pack.Pack{}
+	if err := p.Read(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+	return p, nil
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatalf("usage: %s OLD NEW", os.Args[0])
+	}
+
+	a, err := load(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := load(os.Args[2])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, d := range pack.DiffPacks(a, b) {
+		fmt.Println(d)
+		for _, c := range d.Changes {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+}
@@ -4,9 +4,11 @@ go 1.16
 
 require (
 	github.com/gabriel-vasile/mimetype v1.3.2-0.20210701073822-20e466f2061e
+	github.com/go-audio/audio v1.0.0
 	github.com/go-audio/wav v1.0.0
 	github.com/google/go-cmp v0.5.5
 	github.com/orcaman/writerseeker v0.0.0-20200621085525-1d3f536ff85e
 	gitlab.com/gomidi/midi v1.23.4
 	golang.org/x/net v0.0.0-20210614182718-04defd469f4e // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
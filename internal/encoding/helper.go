@@ -32,6 +32,16 @@ func readByteReader(r io.ByteReader, p []byte) (n int, err error) {
 	return
 }
 
+func writeByteWriter(w io.ByteWriter, p []byte) (n int, err error) {
+	for _, c := range p {
+		if err = w.WriteByte(c); err != nil {
+			return
+		}
+		n++
+	}
+	return
+}
+
 func readerToByteReader(r io.Reader) io.ByteReader {
 	if br, ok := r.(io.ByteReader); ok {
 		return br
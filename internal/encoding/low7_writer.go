@@ -0,0 +1,60 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"io"
+)
+
+type Low7Writer struct {
+	w     io.Writer
+	block []byte
+}
+
+func NewLow7Writer(w io.Writer) *Low7Writer {
+	return &Low7Writer{w: w}
+}
+
+func (w *Low7Writer) WriteByte(c byte) error {
+	w.block = append(w.block, c)
+	if len(w.block) == 7 {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (w *Low7Writer) Write(p []byte) (n int, err error) {
+	return writeByteWriter(w, p)
+}
+
+// Flush writes the pending partial block, if any.
+func (w *Low7Writer) Flush() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+
+	out := make([]byte, len(w.block)+1)
+	for i, c := range w.block {
+		out[0] |= (c >> 7) << i
+		out[i+1] = c & 0x7f
+	}
+	w.block = w.block[:0]
+
+	_, err := w.w.Write(out)
+	return err
+}
+
+var _ io.ByteWriter = (*Low7Writer)(nil)
+var _ io.Writer = (*Low7Writer)(nil)
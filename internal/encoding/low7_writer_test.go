@@ -0,0 +1,64 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLow7Writer(t *testing.T) {
+	data := []struct {
+		name     string
+		dec, enc []byte
+	}{
+		{
+			name: "full block",
+			dec:  []byte{ /**/ 0x40, 0x01, 0x10, 0x80, 0xbb, 0x00, 0x00},
+			enc:  []byte{0x18, 0x40, 0x01, 0x10, 0x00, 0x3b, 0x00, 0x00},
+		},
+		{
+			name: "partial block",
+			dec:  []byte{ /**/ 0x40, 0x01, 0x10, 0x80, 0xbb},
+			enc:  []byte{0x18, 0x40, 0x01, 0x10, 0x00, 0x3b},
+		},
+		{
+			name: "several blocks",
+			dec:  []byte{ /**/ 0x40, 0x01, 0x10, 0x80, 0xbb, 0x00, 0x00 /**/, 0xff},
+			enc:  []byte{0x18, 0x40, 0x01, 0x10, 0x00, 0x3b, 0x00, 0x00, 0x01, 0x7f},
+		},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := new(bytes.Buffer)
+			w := NewLow7Writer(buf)
+			if _, err := w.Write(tt.dec); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.enc, buf.Bytes()); diff != "" {
+				t.Errorf("Write() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"io"
+)
+
+type NybbleWriter struct {
+	w io.Writer
+}
+
+func NewNybbleWriter(w io.Writer) *NybbleWriter {
+	return &NybbleWriter{w: w}
+}
+
+func (w *NybbleWriter) WriteByte(c byte) error {
+	_, err := w.w.Write([]byte{c >> 4, c & 0x0f})
+	return err
+}
+
+func (w *NybbleWriter) Write(p []byte) (n int, err error) {
+	return writeByteWriter(w, p)
+}
+
+var _ io.ByteWriter = (*NybbleWriter)(nil)
+var _ io.Writer = (*NybbleWriter)(nil)
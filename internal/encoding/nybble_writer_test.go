@@ -0,0 +1,55 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNybbleWriter(t *testing.T) {
+	data := []struct {
+		name     string
+		dec, enc []byte
+	}{
+		{
+			name: "valid",
+			dec:  []byte{0x00, 0x23, 0xb0, 0x00},
+			enc:  []byte{0x00, 0x00, 0x02, 0x03, 0x0b, 0x00, 0x00, 0x00},
+		},
+		{
+			name: "empty",
+			dec:  []byte{},
+			enc:  nil,
+		},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := new(bytes.Buffer)
+			if _, err := NewNybbleWriter(buf).Write(tt.dec); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.enc, buf.Bytes()); diff != "" {
+				t.Errorf("Write() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
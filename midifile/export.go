@@ -0,0 +1,265 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package midifile converts Circuit projects from and to Standard MIDI Files.
+package midifile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"gitlab.com/gomidi/midi/smf"
+	"gitlab.com/gomidi/midi/smf/smfwriter"
+	"gitlab.com/gomidi/midi/writer"
+	"yrh.dev/circuit/model"
+	"yrh.dev/circuit/pack"
+)
+
+const (
+	// Resolution is the number of ticks per quarter note used in the files.
+	Resolution = 96
+
+	stepTicks  = Resolution / 4
+	microTicks = stepTicks / pack.MicroSteps
+
+	defaultTempo = 120
+	drumChannel  = 9
+)
+
+// drumNotes are the MIDI notes the Circuit uses for its drum tracks.
+var drumNotes = []uint8{60, 62, 64, 65}
+
+// trackChannels returns the MIDI channel of each track, as configured out of
+// the box.
+func trackChannels(kinds []pack.TrackKind) []uint8 {
+	var channels []uint8
+	next := uint8(0)
+	for _, k := range kinds {
+		if k == pack.TrackDrum {
+			channels = append(channels, drumChannel)
+			continue
+		}
+		channels = append(channels, next)
+		next++
+	}
+	return channels
+}
+
+type event struct {
+	tick     uint64
+	on       bool
+	key, vel uint8
+}
+
+// patternSteps returns the indices of the steps of the pattern, in playing
+// order. Random playback is rendered as forward.
+func patternSteps(pat *pack.Pattern) []int {
+	var steps []int
+	for i := int(pat.Start); i <= int(pat.End); i++ {
+		steps = append(steps, i)
+	}
+	switch pat.Direction {
+	case pack.DirectionReverse:
+		for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+			steps[i], steps[j] = steps[j], steps[i]
+		}
+	case pack.DirectionPingPong:
+		for i := len(steps) - 2; i > 0; i-- {
+			steps = append(steps, steps[i])
+		}
+	}
+	return steps
+}
+
+// patternSource returns the pattern at index for a track.
+type patternSource func(track, index int) (*pack.Pattern, error)
+
+type trackPlayer struct {
+	patterns patternSource
+	track    int
+	kind     pack.TrackKind
+	number   int
+	events   []event
+}
+
+// chainSteps returns the steps played by a chain of patterns, in order.
+func (t *trackPlayer) chainSteps(c pack.Chain) ([]pack.Step, error) {
+	if c.Start > c.End {
+		return nil, fmt.Errorf("invalid chain: %d-%d", c.Start, c.End)
+	}
+	var steps []pack.Step
+	for i := int(c.Start); i <= int(c.End); i++ {
+		pat, err := t.patterns(t.track, i)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range patternSteps(pat) {
+			steps = append(steps, pat.Steps[s])
+		}
+	}
+	return steps, nil
+}
+
+func (t *trackPlayer) play(start uint64, s *pack.Step) {
+	for _, n := range s.ActiveNotes() {
+		key := n.Number
+		if t.kind == pack.TrackDrum {
+			key = drumNotes[t.number]
+		}
+		gate := uint64(n.Gate)
+		if gate == 0 {
+			gate = pack.MicroSteps
+		}
+		on := start + uint64(n.Micro)*microTicks
+		t.events = append(t.events,
+			event{tick: on, on: true, key: key, vel: n.Velocity},
+			event{tick: on + gate*microTicks, key: key})
+	}
+}
+
+// Export writes the project as a multi-track Standard MIDI File. The first
+// track holds the tempo map, followed by one track per project track. The
+// scene chain is unrolled into linear time: every track loops over its
+// pattern chain until the longest chain of the scene is over.
+// Step probabilities are ignored, all the steps are played. Like the
+// decoded view of projects, it returns pack.ErrUnverifiedLayout until the
+// project layout of the flavor is verified.
+func Export(w io.Writer, p *pack.Project, f *model.Flavor) error {
+	s, err := p.Session(f)
+	if err != nil {
+		return err
+	}
+	return export(w, f, s, func(track, index int) (*pack.Pattern, error) {
+		return p.Pattern(f, track, index)
+	})
+}
+
+// export writes the session as a Standard MIDI File, reading the patterns
+// from src.
+func export(w io.Writer, f *model.Flavor, s *pack.Session, src patternSource) error {
+	kinds := pack.TrackKinds(f)
+	if n := len(s.Tracks); n != len(kinds) {
+		return fmt.Errorf("wrong number of tracks: want %d, got %d", len(kinds), n)
+	}
+	channels := trackChannels(kinds)
+
+	players := make([]*trackPlayer, len(kinds))
+	count := make(map[pack.TrackKind]int)
+	for i, k := range kinds {
+		players[i] = &trackPlayer{patterns: src, track: i, kind: k, number: count[k]}
+		count[k]++
+	}
+
+	var err error
+	var tick uint64
+	if c := s.SceneChain; c.Start > c.End || int(c.End) >= len(s.Scenes) {
+		return fmt.Errorf("invalid scene chain: %d-%d", c.Start, c.End)
+	}
+	for sc := int(s.SceneChain.Start); sc <= int(s.SceneChain.End); sc++ {
+		scene := s.Scenes[sc]
+		if n := len(scene.Chains); n != len(kinds) {
+			return fmt.Errorf("scene %d: wrong number of chains: want %d, got %d", sc, len(kinds), n)
+		}
+		steps := make([][]pack.Step, len(kinds))
+		length := 0
+		for i, t := range players {
+			if steps[i], err = t.chainSteps(scene.Chains[i]); err != nil {
+				return err
+			}
+			if n := len(steps[i]); n > length {
+				length = n
+			}
+		}
+		for i, t := range players {
+			for j := 0; j < length; j++ {
+				step := steps[i][j%len(steps[i])]
+				t.play(tick+uint64(j)*stepTicks, &step)
+			}
+		}
+		tick += uint64(length) * stepTicks
+	}
+
+	tempo := float64(s.Settings.Tempo)
+	if tempo == 0 {
+		tempo = defaultTempo
+	}
+
+	wr := writer.NewSMF(w, uint16(len(kinds)+1),
+		smfwriter.TimeFormat(smf.MetricTicks(Resolution)))
+
+	if err := writer.TrackSequenceName(wr, s.Name); err != nil {
+		return err
+	}
+	if err := writer.Meter(wr, 4, 4); err != nil {
+		return err
+	}
+	if err := writer.TempoBPM(wr, tempo); err != nil {
+		return err
+	}
+	if err := writer.EndOfTrack(wr); err != nil {
+		return err
+	}
+
+	for i, t := range players {
+		if err := writeTrack(wr, t, channels[i], &s.Tracks[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeTrack(wr *writer.SMF, t *trackPlayer, channel uint8, settings *pack.TrackSettings) error {
+	wr.SetChannel(channel)
+
+	if err := writer.TrackSequenceName(wr, fmt.Sprintf("%s %d", t.kind, t.number+1)); err != nil {
+		return err
+	}
+	if t.kind == pack.TrackSynth {
+		if err := writer.ProgramChange(wr, settings.Patch); err != nil {
+			return err
+		}
+	}
+
+	// Note offs go first, so that retriggered notes are not cut.
+	sort.SliceStable(t.events, func(i, j int) bool {
+		a, b := t.events[i], t.events[j]
+		if a.tick != b.tick {
+			return a.tick < b.tick
+		}
+		return !a.on && b.on
+	})
+
+	var last uint64
+	for _, e := range t.events {
+		wr.SetDelta(uint32(e.tick - last))
+		last = e.tick
+		var err error
+		if e.on {
+			err = writer.NoteOn(wr, e.key, e.vel)
+		} else {
+			err = writer.NoteOff(wr, e.key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The last track reports the file as finished.
+	if err := writer.EndOfTrack(wr); err != nil && err != smf.ErrFinished {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midifile
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gitlab.com/gomidi/midi/reader"
+	"gitlab.com/gomidi/midi/smf"
+	"yrh.dev/circuit/model"
+	"yrh.dev/circuit/pack"
+)
+
+type noteOn struct {
+	Track   int16
+	Tick    uint64
+	Channel uint8
+	Key     uint8
+}
+
+func readNotes(t *testing.T, data []byte) []noteOn {
+	t.Helper()
+
+	var notes []noteOn
+	rd := reader.New(reader.NoLogger(),
+		reader.NoteOn(func(p *reader.Position, channel, key, velocity uint8) {
+			notes = append(notes, noteOn{p.Track, p.AbsoluteTicks, channel, key})
+		}),
+	)
+	if err := reader.ReadSMF(rd, bytes.NewReader(data)); err != nil && err != smf.ErrFinished {
+		t.Fatal(err)
+	}
+	return notes
+}
+
+// testPatterns holds patterns by track and index. Missing patterns read as
+// those of an empty project: a single step with no notes.
+type testPatterns map[[2]int]*pack.Pattern
+
+func (tp testPatterns) source(f *model.Flavor) patternSource {
+	return func(track, index int) (*pack.Pattern, error) {
+		if pat := tp[[2]int{track, index}]; pat != nil {
+			return pat, nil
+		}
+		empty, err := pack.NewPattern(f)
+		if err != nil {
+			return nil, err
+		}
+		empty.End = 0
+		return empty, nil
+	}
+}
+
+func emptySession(f *model.Flavor) *pack.Session {
+	kinds := pack.TrackKinds(f)
+	return &pack.Session{
+		Tracks: make([]pack.TrackSettings, len(kinds)),
+		Scenes: []pack.Scene{{Chains: make([]pack.Chain, len(kinds))}},
+	}
+}
+
+// testSong returns a session and its patterns: two synth patterns chained
+// on the first track, and a kick on the first drum track.
+func testSong(t *testing.T, f *model.Flavor) (*pack.Session, testPatterns) {
+	t.Helper()
+
+	s := emptySession(f)
+	s.Settings.Tempo = 100
+	s.Scenes[0].Chains[0] = pack.Chain{Start: 0, End: 1}
+
+	patterns := make(testPatterns)
+	for i, key := range []byte{60, 67} {
+		pat, err := pack.NewPattern(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pat.End = 3
+		if err := pat.Steps[1].AddNote(pack.Note{Number: key, Velocity: 100, Gate: 6, Micro: 3}); err != nil {
+			t.Fatal(err)
+		}
+		patterns[[2]int{0, i}] = pat
+	}
+
+	kick, err := pack.NewPattern(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kick.End = 1
+	if err := kick.Steps[0].AddNote(pack.Note{Velocity: 127}); err != nil {
+		t.Fatal(err)
+	}
+	patterns[[2]int{2, 0}] = kick
+
+	return s, patterns
+}
+
+func TestExport(t *testing.T) {
+	f := model.Circuit
+	s, patterns := testSong(t, f)
+
+	buf := new(bytes.Buffer)
+	if err := export(buf, f, s, patterns.source(f)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []noteOn{
+		{Track: 1, Tick: 1*stepTicks + 3*microTicks, Channel: 0, Key: 60},
+		{Track: 1, Tick: 5*stepTicks + 3*microTicks, Channel: 0, Key: 67},
+		{Track: 3, Tick: 0, Channel: drumChannel, Key: 60},
+		{Track: 3, Tick: 2 * stepTicks, Channel: drumChannel, Key: 60},
+		{Track: 3, Tick: 4 * stepTicks, Channel: drumChannel, Key: 60},
+		{Track: 3, Tick: 6 * stepTicks, Channel: drumChannel, Key: 60},
+	}
+	if diff := cmp.Diff(want, readNotes(t, buf.Bytes())); diff != "" {
+		t.Errorf("Export() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// forDeviceProjects runs fn on every project saved by a device in
+// pack/testdata/projects, skipping the flavors with none.
+func forDeviceProjects(t *testing.T, fn func(t *testing.T, f *model.Flavor, p *pack.Project)) {
+	for dir, f := range map[string]*model.Flavor{
+		"circuit":        model.Circuit,
+		"circuit-tracks": model.CircuitTracks,
+	} {
+		dir, f := dir, f
+		files, err := filepath.Glob(filepath.Join("..", "pack", "testdata", "projects", dir, "*.ncs"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(f.Name, func(t *testing.T) {
+			t.Parallel()
+
+			if len(files) == 0 {
+				t.Skipf("no %s project in pack/testdata/projects/%s", f.Name, dir)
+			}
+			for _, fname := range files {
+				data, err := os.ReadFile(fname)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Run(filepath.Base(fname), func(t *testing.T) {
+					fn(t, f, pack.NewProject(filepath.Base(fname), data))
+				})
+			}
+		})
+	}
+}
+
+func TestExportDeviceProjects(t *testing.T) {
+	forDeviceProjects(t, func(t *testing.T, f *model.Flavor, p *pack.Project) {
+		buf := new(bytes.Buffer)
+		if err := Export(buf, p, f); err != nil {
+			t.Fatal(err)
+		}
+		readNotes(t, buf.Bytes())
+	})
+}
+
+func TestUnverifiedLayout(t *testing.T) {
+	t.Parallel()
+
+	f := model.CircuitTracks
+	s, patterns := testSong(t, f)
+	buf := new(bytes.Buffer)
+	if err := export(buf, f, s, patterns.source(f)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Export(new(bytes.Buffer), &pack.Project{}, f); !errors.Is(err, pack.ErrUnverifiedLayout) {
+		t.Errorf("Export() = %v, want %v", err, pack.ErrUnverifiedLayout)
+	}
+	if _, _, err := Import(buf, f, nil); !errors.Is(err, pack.ErrUnverifiedLayout) {
+		t.Errorf("Import() = %v, want %v", err, pack.ErrUnverifiedLayout)
+	}
+}
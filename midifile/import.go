@@ -0,0 +1,300 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midifile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"gitlab.com/gomidi/midi/reader"
+	"gitlab.com/gomidi/midi/smf"
+	"yrh.dev/circuit/model"
+	"yrh.dev/circuit/pack"
+)
+
+const (
+	minTempo = 40
+	maxTempo = 240
+)
+
+// ImportOptions controls how MIDI channels are mapped onto project tracks.
+type ImportOptions struct {
+	// Channels maps MIDI channels to project tracks. Notes on a channel
+	// mapped to a drum track all trigger that track. By default, channels
+	// follow the device configuration: synth and MIDI tracks on the first
+	// channels, and drums on channel 10, split by note.
+	Channels map[uint8]int
+}
+
+// Dropped is a note that could not be stored in the project.
+type Dropped struct {
+	Track   int16
+	Tick    uint64
+	Channel uint8
+	Key     uint8
+	Reason  string
+}
+
+func (d *Dropped) String() string {
+	return fmt.Sprintf("track %d, tick %d, channel %d, note %d: %s",
+		d.Track, d.Tick, d.Channel+1, d.Key, d.Reason)
+}
+
+// Report lists the notes that did not fit in the project.
+type Report struct {
+	Dropped []*Dropped
+}
+
+type midiNote struct {
+	track    int16
+	channel  uint8
+	key, vel uint8
+	on, off  uint64
+}
+
+type noteKey struct {
+	track        int16
+	channel, key uint8
+}
+
+// Import reads a Standard MIDI File and quantizes its notes onto the pattern
+// grid of a new project. Notes are aligned on micro-steps, and parts longer
+// than a pattern are spread over a chain of patterns played by the first
+// scene. It returns pack.ErrUnverifiedLayout until the project layout of the
+// flavor is verified.
+func Import(r io.Reader, f *model.Flavor, opts *ImportOptions) (*pack.Project, *Report, error) {
+	sg, report, err := quantize(r, f, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := pack.NewProject(sg.name, nil)
+	s, err := p.Session(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	sg.apply(s)
+	if err := p.SetSession(f, s); err != nil {
+		return nil, nil, err
+	}
+	for i := range sg.patterns {
+		for j := 0; j < sg.used; j++ {
+			if err := p.SetPattern(f, i, j, sg.patterns[i][j]); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return p, report, nil
+}
+
+// song is a quantized Standard MIDI File.
+type song struct {
+	name  string
+	tempo float64
+	// patterns holds the patterns of every track, of which the first used
+	// are chained.
+	patterns [][]*pack.Pattern
+	used     int
+}
+
+// apply sets the name, tempo and first scene of the session.
+func (sg *song) apply(s *pack.Session) {
+	s.Name = sg.name
+	tempo := sg.tempo
+	if tempo == 0 {
+		tempo = defaultTempo
+	}
+	s.Settings.Tempo = byte(math.Max(minTempo, math.Min(maxTempo, math.Round(tempo))))
+	for i := range s.Scenes[0].Chains {
+		s.Scenes[0].Chains[i] = pack.Chain{Start: 0, End: byte(sg.used - 1)}
+	}
+}
+
+// quantize reads a Standard MIDI File and quantizes its notes onto the
+// pattern grid of the flavor.
+func quantize(r io.Reader, f *model.Flavor, opts *ImportOptions) (*song, *Report, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	kinds := pack.TrackKinds(f)
+	if kinds == nil {
+		return nil, nil, fmt.Errorf("unsupported flavor: %s", f.Name)
+	}
+
+	var (
+		notes   []*midiNote
+		pending = make(map[noteKey]*midiNote)
+		tempo   float64
+		name    string
+	)
+
+	noteOff := func(p *reader.Position, channel, key uint8) {
+		k := noteKey{p.Track, channel, key}
+		if n := pending[k]; n != nil {
+			n.off = p.AbsoluteTicks
+			delete(pending, k)
+		}
+	}
+
+	rd := reader.New(reader.NoLogger(),
+		reader.NoteOn(func(p *reader.Position, channel, key, velocity uint8) {
+			if velocity == 0 {
+				noteOff(p, channel, key)
+				return
+			}
+			noteOff(p, channel, key)
+			n := &midiNote{track: p.Track, channel: channel, key: key, vel: velocity, on: p.AbsoluteTicks}
+			pending[noteKey{p.Track, channel, key}] = n
+			notes = append(notes, n)
+		}),
+		reader.NoteOff(func(p *reader.Position, channel, key, _ uint8) {
+			noteOff(p, channel, key)
+		}),
+		reader.TempoBPM(func(p reader.Position, bpm float64) {
+			if tempo == 0 {
+				tempo = bpm
+			}
+		}),
+		reader.TrackSequenceName(func(p reader.Position, n string) {
+			if p.Track == 0 && name == "" {
+				name = n
+			}
+		}),
+	)
+	if err := reader.ReadSMF(rd, r); err != nil && err != smf.ErrFinished {
+		return nil, nil, err
+	}
+
+	mt, ok := rd.Header().TimeFormat.(smf.MetricTicks)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported time format: %v", rd.Header().TimeFormat)
+	}
+	micro := float64(mt.Resolution()) / 4 / pack.MicroSteps
+
+	// Notes that are never released last until the end of the step.
+	for _, n := range pending {
+		n.off = n.on + uint64(micro*pack.MicroSteps)
+	}
+
+	empty, err := pack.NewPattern(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	numSteps := len(empty.Steps)
+
+	patterns := make([][]*pack.Pattern, len(kinds))
+	for i := range patterns {
+		patterns[i] = make([]*pack.Pattern, pack.PatternsPerTrack)
+		for j := range patterns[i] {
+			patterns[i][j], _ = pack.NewPattern(f)
+		}
+	}
+
+	channels := opts.Channels
+	if channels == nil {
+		channels = make(map[uint8]int)
+		for i, c := range trackChannels(kinds) {
+			if kinds[i] != pack.TrackDrum {
+				channels[c] = i
+			}
+		}
+	}
+	drumTracks := make(map[uint8]int)
+	for i, k := range kinds {
+		if k == pack.TrackDrum && len(drumTracks) < len(drumNotes) {
+			drumTracks[drumNotes[len(drumTracks)]] = i
+		}
+	}
+
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].on < notes[j].on
+	})
+
+	report := &Report{}
+	drop := func(n *midiNote, reason string) {
+		report.Dropped = append(report.Dropped, &Dropped{
+			Track:   n.track,
+			Tick:    n.on,
+			Channel: n.channel,
+			Key:     n.key,
+			Reason:  reason,
+		})
+	}
+
+	used := 1
+	for _, n := range notes {
+		track, ok := channels[n.channel]
+		if !ok && n.channel == drumChannel && opts.Channels == nil {
+			if track, ok = drumTracks[n.key]; !ok {
+				drop(n, "no drum track for note")
+				continue
+			}
+		}
+		if !ok {
+			drop(n, "channel not mapped to a track")
+			continue
+		}
+		if track < 0 || track >= len(kinds) {
+			drop(n, fmt.Sprintf("invalid track %d", track))
+			continue
+		}
+
+		pos := int(math.Round(float64(n.on) / micro))
+		step := pos / pack.MicroSteps
+		index := step / numSteps
+		if index >= pack.PatternsPerTrack {
+			drop(n, "beyond the last pattern")
+			continue
+		}
+
+		gate := math.Round(float64(n.off-n.on) / micro)
+		if gate < 1 {
+			gate = 1
+		}
+		if gate > math.MaxUint8 {
+			gate = math.MaxUint8
+		}
+
+		s := &patterns[track][index].Steps[step%numSteps]
+		note := pack.Note{
+			Number:   n.key,
+			Velocity: n.vel,
+			Gate:     byte(gate),
+			Micro:    byte(pos % pack.MicroSteps),
+		}
+		if kinds[track] == pack.TrackDrum {
+			if s.Active() {
+				drop(n, "drum step already used")
+				continue
+			}
+			note.Number = 0
+		}
+		if err := s.AddNote(note); err != nil {
+			drop(n, "polyphony exceeded")
+			continue
+		}
+		if index+1 > used {
+			used = index + 1
+		}
+	}
+
+	if len(name) > pack.ProjectNameSize {
+		name = name[:pack.ProjectNameSize]
+	}
+	return &song{name: name, tempo: tempo, patterns: patterns, used: used}, report, nil
+}
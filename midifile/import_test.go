@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package midifile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gitlab.com/gomidi/midi/smf"
+	"gitlab.com/gomidi/midi/smf/smfwriter"
+	"gitlab.com/gomidi/midi/writer"
+	"yrh.dev/circuit/model"
+	"yrh.dev/circuit/pack"
+)
+
+func (sg *song) source() patternSource {
+	return func(track, index int) (*pack.Pattern, error) {
+		return sg.patterns[track][index], nil
+	}
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	f := model.Circuit
+
+	s, patterns := testSong(t, f)
+	exported := new(bytes.Buffer)
+	if err := export(exported, f, s, patterns.source(f)); err != nil {
+		t.Fatal(err)
+	}
+
+	sg, report, err := quantize(bytes.NewReader(exported.Bytes()), f, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(report.Dropped); n != 0 {
+		t.Errorf("Import() dropped %d notes", n)
+	}
+	s = emptySession(f)
+	sg.apply(s)
+	if s.Settings.Tempo != 100 {
+		t.Errorf("Import() tempo = %d, want 100", s.Settings.Tempo)
+	}
+
+	reexported := new(bytes.Buffer)
+	if err := export(reexported, f, s, sg.source()); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(readNotes(t, exported.Bytes()), readNotes(t, reexported.Bytes())); diff != "" {
+		t.Errorf("Import() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestImportDeviceProjects(t *testing.T) {
+	forDeviceProjects(t, func(t *testing.T, f *model.Flavor, p *pack.Project) {
+		exported := new(bytes.Buffer)
+		if err := Export(exported, p, f); err != nil {
+			t.Fatal(err)
+		}
+		imported, _, err := Import(bytes.NewReader(exported.Bytes()), f, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Scene chains and random playback don't survive the round trip,
+		// so only check that the imported project can be read back.
+		if err := Export(new(bytes.Buffer), imported, f); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestImportDropped(t *testing.T) {
+	buf := new(bytes.Buffer)
+	wr := writer.NewSMF(buf, 1, smfwriter.TimeFormat(smf.MetricTicks(Resolution)))
+	for key := uint8(60); key < 67; key++ {
+		if err := writer.NoteOn(wr, key, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wr.SetChannel(drumChannel)
+	if err := writer.NoteOn(wr, 70, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.EndOfTrack(wr); err != nil && err != smf.ErrFinished {
+		t.Fatal(err)
+	}
+
+	_, report, err := quantize(buf, model.CircuitTracks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, d := range report.Dropped {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"track 0, tick 0, channel 1, note 66: polyphony exceeded",
+		"track 0, tick 0, channel 10, note 70: no drum track for note",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Import() dropped mismatch (-want +got):\n%s", diff)
+	}
+}
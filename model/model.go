@@ -27,6 +27,20 @@ type Flavor struct {
 	NumberProjects int
 	NumberSamples  int
 	NumberPatches  int
+
+	// SampleRate, SampleBitDepth and SampleChannels describe the WAV format
+	// the device expects for samples.
+	SampleRate     int
+	SampleBitDepth int
+	SampleChannels int
+
+	// SampleMemory is the total size in bytes of the samples, once in the
+	// device format. MaxSampleFrames is the length of the longest sample the
+	// device plays in full. Zero means the limit is unknown and isn't
+	// enforced, which is the case for every flavor until the limits are
+	// measured on a device.
+	SampleMemory    int
+	MaxSampleFrames int
 }
 
 func (f *Flavor) SysExSamplePrefix() []byte {
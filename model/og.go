@@ -22,5 +22,8 @@ var (
 		NumberProjects: 32,
 		NumberSamples:  64,
 		NumberPatches:  64,
+		SampleRate:     48000,
+		SampleBitDepth: 16,
+		SampleChannels: 1,
 	}
 )
@@ -22,5 +22,8 @@ var (
 		NumberProjects: 64,
 		NumberSamples:  64,
 		NumberPatches:  128,
+		SampleRate:     48000,
+		SampleBitDepth: 16,
+		SampleChannels: 1,
 	}
 )
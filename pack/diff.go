@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import "fmt"
+
+// Change is a parameter that differs between two patches.
+type Change struct {
+	Path     string
+	Old, New string
+}
+
+func (c *Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// DiffPatches compares two patches parameter by parameter. A nil patch is an
+// empty slot, compared as InitPatch. Reserved bytes are ignored.
+func DiffPatches(a, b *Patch) []*Change {
+	if a == nil {
+		a = InitPatch()
+	}
+	if b == nil {
+		b = InitPatch()
+	}
+
+	var changes []*Change
+	if a.PatchName != b.PatchName {
+		changes = append(changes, &Change{
+			Path: "Name",
+			Old:  fmt.Sprintf("%q", a.Name()),
+			New:  fmt.Sprintf("%q", b.Name()),
+		})
+	}
+	for _, param := range params {
+		va, vb := byte(param.field(a).Uint()), byte(param.field(b).Uint())
+		if va != vb {
+			changes = append(changes, &Change{
+				Path: param.Path,
+				Old:  param.Format(va),
+				New:  param.Format(vb),
+			})
+		}
+	}
+	return changes
+}
+
+// SlotDiff lists the changes of a single patch slot between two packs.
+type SlotDiff struct {
+	Slot     int
+	Old, New string
+	Changes  []*Change
+}
+
+func (d *SlotDiff) String() string {
+	if d.Old == d.New {
+		return fmt.Sprintf("slot %d (%s): %d changes", d.Slot+1, d.Old, len(d.Changes))
+	}
+	return fmt.Sprintf("slot %d (%s -> %s): %d changes", d.Slot+1, d.Old, d.New, len(d.Changes))
+}
+
+func slotName(p *Patch) string {
+	if p == nil {
+		return "-"
+	}
+	return p.Name()
+}
+
+// DiffPacks compares the patch slots of two packs, and returns the slots that
+// changed.
+func DiffPacks(a, b *Pack) []*SlotDiff {
+	n := len(a.Patches)
+	if len(b.Patches) > n {
+		n = len(b.Patches)
+	}
+
+	var diffs []*SlotDiff
+	for i := 0; i < n; i++ {
+		var pa, pb *Patch
+		if i < len(a.Patches) {
+			pa = a.Patches[i]
+		}
+		if i < len(b.Patches) {
+			pb = b.Patches[i]
+		}
+		if changes := DiffPatches(pa, pb); len(changes) > 0 {
+			diffs = append(diffs, &SlotDiff{
+				Slot:    i,
+				Old:     slotName(pa),
+				New:     slotName(pb),
+				Changes: changes,
+			})
+		}
+	}
+	return diffs
+}
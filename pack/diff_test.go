@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffPatches(t *testing.T) {
+	a := testPatch("Bass 1          ")
+	b := testPatch("Bass 2          ")
+	a.Osc1.Semitones = 64
+	b.Osc1.Semitones = 76
+	b.Filter.Type = FilterHighPass12
+	b.Reserved[0] = 1
+
+	var got []string
+	for _, c := range DiffPatches(a, b) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`Name: "Bass 1" -> "Bass 2"`,
+		"Osc1.Semitones: +0 semitones -> +12 semitones",
+		"Filter.Type: low-pass 12dB -> high-pass 12dB",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DiffPatches() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffPatchesNil(t *testing.T) {
+	t.Parallel()
+
+	if changes := DiffPatches(nil, InitPatch()); len(changes) != 0 {
+		t.Errorf("DiffPatches(nil, InitPatch()) = %v, want no change", changes)
+	}
+}
+
+func TestDiffPacks(t *testing.T) {
+	a := &Pack{Patches: []*Patch{testPatch("Same"), testPatch("Old")}}
+	b := &Pack{Patches: []*Patch{testPatch("Same"), testPatch("New"), InitPatch(), InitPatch()}}
+	b.Patches[2].Filter.Frequency = 100
+	_ = b.Patches[2].SetName("Added")
+
+	var got []string
+	for _, d := range DiffPacks(a, b) {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"slot 2 (Old -> New): 1 changes",
+		"slot 3 (- -> Added): 2 changes",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("DiffPacks() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"sort"
+)
+
+// Fingerprint identifies the sound of a patch.
+type Fingerprint [sha256.Size]byte
+
+func (f Fingerprint) String() string {
+	return hex.EncodeToString(f[:])
+}
+
+// soundParams are the parameters shaping the sound of a patch, that is all of
+// them but the metadata.
+var soundParams = func() []*Param {
+	var res []*Param
+	for _, param := range params {
+		if param.Path == "Category" || param.Path == "Genre" {
+			continue
+		}
+		res = append(res, param)
+	}
+	return res
+}()
+
+// Fingerprint returns a hash of the patch ignoring its name, category, genre
+// and reserved bytes. It is stable across releases as long as the patch
+// layout doesn't change.
+func (p *Patch) Fingerprint() Fingerprint {
+	return sha256.Sum256(soundVector(p))
+}
+
+// soundVector returns the values of the sound parameters of p.
+func soundVector(p *Patch) []byte {
+	v := make([]byte, len(soundParams))
+	for i, param := range soundParams {
+		v[i] = byte(param.field(p).Uint())
+	}
+	return v
+}
+
+// continuous reports whether differences of the parameter are measured in
+// fractions of its range.
+func continuous(param *Param) bool {
+	return !param.Discrete && param.Max > param.Min
+}
+
+// Distance returns how different two patches sound, from 0 for identical
+// parameters to 1 for patches differing in every parameter by the full
+// range. Discrete parameters count as fully different when they don't match.
+// A nil patch is an empty slot, compared as InitPatch.
+func Distance(a, b *Patch) float64 {
+	if a == nil {
+		a = InitPatch()
+	}
+	if b == nil {
+		b = InitPatch()
+	}
+	return distance(soundVector(a), soundVector(b))
+}
+
+func distance(a, b []byte) float64 {
+	var sum float64
+	for i, param := range soundParams {
+		switch {
+		case a[i] == b[i]:
+		case !continuous(param):
+			sum++
+		default:
+			sum += math.Abs(float64(a[i])-float64(b[i])) / float64(param.Max-param.Min)
+		}
+	}
+	return sum / float64(len(soundParams))
+}
+
+// vectorSum adds up the continuous parameters of a sound vector, in fractions
+// of their range. The sums of two patches differ by at most their distance
+// times the number of parameters.
+func vectorSum(v []byte) float64 {
+	var sum float64
+	for i, param := range soundParams {
+		if continuous(param) {
+			sum += float64(v[i]) / float64(param.Max-param.Min)
+		}
+	}
+	return sum
+}
+
+// PatchLocation is a patch found in a file.
+type PatchLocation struct {
+	Source string
+	Slot   int
+	Patch  *Patch
+}
+
+// DuplicateGroup is a set of patches sounding the same or nearly so.
+type DuplicateGroup struct {
+	// Exact is true when all patches have the same fingerprint.
+	Exact   bool
+	Patches []*PatchLocation
+}
+
+// DuplicateScanner finds duplicate patches across packs.
+type DuplicateScanner struct {
+	// Threshold is the largest distance between two patches considered
+	// near-identical. At 0, only exact duplicates are reported.
+	Threshold float64
+
+	order  []Fingerprint
+	groups map[Fingerprint][]*PatchLocation
+	// vectors and sums are those of the first patch of each fingerprint, in
+	// order.
+	vectors [][]byte
+	sums    []float64
+}
+
+// AddPatch records a patch found in source at slot. Nil patches are ignored.
+func (s *DuplicateScanner) AddPatch(source string, slot int, p *Patch) {
+	if p == nil {
+		return
+	}
+	if s.groups == nil {
+		s.groups = make(map[Fingerprint][]*PatchLocation)
+	}
+	v := soundVector(p)
+	fp := Fingerprint(sha256.Sum256(v))
+	if _, ok := s.groups[fp]; !ok {
+		s.order = append(s.order, fp)
+		s.vectors = append(s.vectors, v)
+		s.sums = append(s.sums, vectorSum(v))
+	}
+	s.groups[fp] = append(s.groups[fp], &PatchLocation{Source: source, Slot: slot, Patch: p})
+}
+
+// AddPack records every patch of the pack.
+func (s *DuplicateScanner) AddPack(source string, p *Pack) {
+	for i, patch := range p.Patches {
+		s.AddPatch(source, i, patch)
+	}
+}
+
+// Groups returns the sets of duplicate patches, in the order they were first
+// added. Patches with no duplicate are left out.
+func (s *DuplicateScanner) Groups() []*DuplicateGroup {
+	// Compare one patch per fingerprint and merge close ones.
+	parent := make([]int, len(s.order))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	if s.Threshold > 0 {
+		// Sorted by sum, the patches close to one another are neighbours:
+		// stop comparing once the sums are too far apart.
+		byScore := make([]int, len(s.order))
+		for i := range byScore {
+			byScore[i] = i
+		}
+		sort.SliceStable(byScore, func(x, y int) bool {
+			return s.sums[byScore[x]] < s.sums[byScore[y]]
+		})
+		limit := s.Threshold*float64(len(soundParams)) + 1e-9
+		for x, i := range byScore {
+			for _, j := range byScore[x+1:] {
+				if s.sums[j]-s.sums[i] > limit {
+					break
+				}
+				if distance(s.vectors[i], s.vectors[j]) <= s.Threshold {
+					ri, rj := find(i), find(j)
+					if ri < rj {
+						parent[rj] = ri
+					} else {
+						parent[ri] = rj
+					}
+				}
+			}
+		}
+	}
+
+	merged := make(map[int]*DuplicateGroup)
+	var res []*DuplicateGroup
+	for i, fp := range s.order {
+		root := find(i)
+		g, ok := merged[root]
+		if !ok {
+			g = &DuplicateGroup{Exact: true}
+			merged[root] = g
+			res = append(res, g)
+		} else {
+			g.Exact = false
+		}
+		g.Patches = append(g.Patches, s.groups[fp]...)
+	}
+
+	var dups []*DuplicateGroup
+	for _, g := range res {
+		if len(g.Patches) > 1 {
+			dups = append(dups, g)
+		}
+	}
+	return dups
+}
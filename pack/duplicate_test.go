@@ -0,0 +1,181 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+
+	a := testPatch("Original")
+	b := testPatch("Copy")
+	b.Category = CategoryLead
+	b.Reserved[3] = 1
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Error("Fingerprint() differs for patches only differing by metadata")
+	}
+	b.Filter.Frequency++
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("Fingerprint() matches for patches with different parameters")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	t.Parallel()
+
+	a := testPatch("A")
+	if got := Distance(a, a); got != 0 {
+		t.Errorf("Distance(a, a) = %v, want 0", got)
+	}
+	b := testPatch("B")
+	b.Filter.Frequency += 127 / 2
+	c := testPatch("C")
+	c.Filter.Frequency += 127
+	if ab, ac := Distance(a, b), Distance(a, c); !(0 < ab && ab < ac) {
+		t.Errorf("Distance(a, b) = %v, Distance(a, c) = %v, want 0 < ab < ac", ab, ac)
+	}
+}
+
+func TestDuplicateScanner(t *testing.T) {
+	t.Parallel()
+
+	near := testPatch("Near")
+	near.Filter.Resonance++
+	other := testPatch("Other")
+	other.Osc1.Wave = WaveSquare
+	other.Mixer.NoiseLevel = 127
+
+	packs := map[string]*Pack{
+		"old.syx": {Patches: []*Patch{testPatch("Bass"), other}},
+		"new.syx": {Patches: []*Patch{nil, testPatch("Bass 2"), near}},
+	}
+
+	type loc struct {
+		Source string
+		Slot   int
+	}
+	groups := func(threshold float64) [][]loc {
+		s := &DuplicateScanner{Threshold: threshold}
+		for _, name := range []string{"old.syx", "new.syx"} {
+			s.AddPack(name, packs[name])
+		}
+		var res [][]loc
+		for _, g := range s.Groups() {
+			var locs []loc
+			for _, p := range g.Patches {
+				locs = append(locs, loc{p.Source, p.Slot})
+			}
+			res = append(res, locs)
+		}
+		return res
+	}
+
+	want := [][]loc{{{"old.syx", 0}, {"new.syx", 1}}}
+	if diff := cmp.Diff(want, groups(0)); diff != "" {
+		t.Errorf("exact Groups() mismatch (-want +got):\n%s", diff)
+	}
+	want = [][]loc{{{"old.syx", 0}, {"new.syx", 1}, {"new.syx", 2}}}
+	if diff := cmp.Diff(want, groups(0.001)); diff != "" {
+		t.Errorf("near Groups() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDistanceNil(t *testing.T) {
+	t.Parallel()
+
+	if d := Distance(nil, InitPatch()); d != 0 {
+		t.Errorf("Distance(nil, InitPatch()) = %v, want 0", d)
+	}
+	if d := Distance(testPatch("A"), nil); d == 0 {
+		t.Errorf("Distance(patch, nil) = 0, want more")
+	}
+}
+
+func TestDuplicateScannerPruning(t *testing.T) {
+	t.Parallel()
+
+	r := NewRandomizer(1)
+	r.Seed = validPatch(t)
+	r.Variation = 0.02
+	var patches []*Patch
+	for i := 0; i < 200; i++ {
+		patches = append(patches, r.Patch())
+	}
+	const threshold = 0.006
+
+	s := &DuplicateScanner{Threshold: threshold}
+	for i, p := range patches {
+		s.AddPatch("pack", i, p)
+	}
+	var got [][]int
+	for _, g := range s.Groups() {
+		var slots []int
+		for _, l := range g.Patches {
+			slots = append(slots, l.Slot)
+		}
+		got = append(got, slots)
+	}
+
+	// Compare every pair.
+	group := make([]int, len(patches))
+	for i := range group {
+		group[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		for group[i] != i {
+			i = group[i]
+		}
+		return i
+	}
+	for i := range patches {
+		for j := i + 1; j < len(patches); j++ {
+			if Distance(patches[i], patches[j]) <= threshold {
+				ri, rj := root(i), root(j)
+				if ri < rj {
+					group[rj] = ri
+				} else {
+					group[ri] = rj
+				}
+			}
+		}
+	}
+	members := make(map[int][]int)
+	var roots []int
+	for i := range patches {
+		ri := root(i)
+		if _, ok := members[ri]; !ok {
+			roots = append(roots, ri)
+		}
+		members[ri] = append(members[ri], i)
+	}
+	var want [][]int
+	for _, ri := range roots {
+		if len(members[ri]) > 1 {
+			want = append(want, members[ri])
+		}
+	}
+
+	if len(want) == 0 {
+		t.Fatal("no near duplicates to find")
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Groups() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,815 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"fmt"
+	"strings"
+)
+
+func enumString(names []string, v byte, typ string) string {
+	if int(v) < len(names) && names[v] != "" {
+		return names[v]
+	}
+	return fmt.Sprintf("%s(%d)", typ, v)
+}
+
+func enumValid(names []string, v byte) bool {
+	return int(v) < len(names) && names[v] != ""
+}
+
+// enumParse is the inverse of enumString.
+func enumParse(names []string, text []byte, typ string) (byte, error) {
+	s := string(text)
+	for i, name := range names {
+		if name != "" && strings.EqualFold(name, s) {
+			return byte(i), nil
+		}
+	}
+	var v byte
+	if _, err := fmt.Sscanf(s, typ+"(%d)", &v); err == nil {
+		return v, nil
+	}
+	return 0, fmt.Errorf("invalid %s: %q", typ, s)
+}
+
+type PolyphonyMode byte
+
+const (
+	PolyphonyMono PolyphonyMode = iota
+	PolyphonyMonoAutoGlide
+	PolyphonyPoly
+)
+
+var polyphonyModeNames = []string{
+	"mono",
+	"mono auto-glide",
+	"poly",
+}
+
+func (m PolyphonyMode) String() string {
+	return enumString(polyphonyModeNames, byte(m), "PolyphonyMode")
+}
+
+func (m PolyphonyMode) Valid() bool {
+	return enumValid(polyphonyModeNames, byte(m))
+}
+
+func (m PolyphonyMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *PolyphonyMode) UnmarshalText(text []byte) error {
+	b, err := enumParse(polyphonyModeNames, text, "PolyphonyMode")
+	*m = PolyphonyMode(b)
+	return err
+}
+
+// Waveform is the waveform of an oscillator.
+type Waveform byte
+
+const (
+	WaveSine Waveform = iota
+	WaveTriangle
+	WaveSawtooth
+	WaveSaw9to1PW
+	WaveSaw8to2PW
+	WaveSaw7to3PW
+	WaveSaw6to4PW
+	WaveSaw5to5PW
+	WaveSaw4to6PW
+	WaveSaw3to7PW
+	WaveSaw2to8PW
+	WaveSaw1to9PW
+	WavePulseWidth
+	WaveSquare
+	WaveSineTable
+	WaveAnaloguePulse
+	WaveAnalogueSync
+	WaveTriangleSawBlend
+	WaveDigitalNasty1
+	WaveDigitalNasty2
+	WaveDigitalSawSquare
+	WaveDigitalVocal1
+	WaveDigitalVocal2
+	WaveDigitalVocal3
+	WaveDigitalVocal4
+	WaveDigitalVocal5
+	WaveDigitalVocal6
+	WaveRandomCollection1
+	WaveRandomCollection2
+	WaveRandomCollection3
+)
+
+var waveformNames = []string{
+	"sine",
+	"triangle",
+	"sawtooth",
+	"saw 9:1 PW",
+	"saw 8:2 PW",
+	"saw 7:3 PW",
+	"saw 6:4 PW",
+	"saw 5:5 PW",
+	"saw 4:6 PW",
+	"saw 3:7 PW",
+	"saw 2:8 PW",
+	"saw 1:9 PW",
+	"pulse width",
+	"square",
+	"sine table",
+	"analogue pulse",
+	"analogue sync",
+	"triangle-saw blend",
+	"digital nasty 1",
+	"digital nasty 2",
+	"digital saw-square",
+	"digital vocal 1",
+	"digital vocal 2",
+	"digital vocal 3",
+	"digital vocal 4",
+	"digital vocal 5",
+	"digital vocal 6",
+	"random collection 1",
+	"random collection 2",
+	"random collection 3",
+}
+
+func (w Waveform) String() string {
+	return enumString(waveformNames, byte(w), "Waveform")
+}
+
+func (w Waveform) Valid() bool {
+	return enumValid(waveformNames, byte(w))
+}
+
+func (w Waveform) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+func (w *Waveform) UnmarshalText(text []byte) error {
+	b, err := enumParse(waveformNames, text, "Waveform")
+	*w = Waveform(b)
+	return err
+}
+
+// LFOWaveform is the waveform of an LFO.
+type LFOWaveform byte
+
+const (
+	LFOSine LFOWaveform = iota
+	LFOTriangle
+	LFOSawtooth
+	LFOSquare
+	LFORandomSH
+	LFOTimeSH
+	LFOPianoEnvelope
+)
+
+var lfoWaveformNames = func() []string {
+	names := []string{
+		"sine",
+		"triangle",
+		"sawtooth",
+		"square",
+		"random S/H",
+		"time S/H",
+		"piano envelope",
+	}
+	for i := 1; i <= 7; i++ {
+		names = append(names, fmt.Sprintf("sequence %d", i))
+	}
+	for i := 1; i <= 8; i++ {
+		names = append(names, fmt.Sprintf("alternative %d", i))
+	}
+	return append(names,
+		"chromatic",
+		"chromatic 16",
+		"major",
+		"major 7",
+		"minor 7",
+		"min arp 1",
+		"min arp 2",
+		"diminished",
+		"dec minor",
+		"minor 3rd",
+		"pedal",
+		"4ths",
+		"4ths x12",
+		"1625 maj",
+		"1625 min",
+		"2511",
+	)
+}()
+
+func (w LFOWaveform) String() string {
+	return enumString(lfoWaveformNames, byte(w), "LFOWaveform")
+}
+
+func (w LFOWaveform) Valid() bool {
+	return enumValid(lfoWaveformNames, byte(w))
+}
+
+func (w LFOWaveform) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+func (w *LFOWaveform) UnmarshalText(text []byte) error {
+	b, err := enumParse(lfoWaveformNames, text, "LFOWaveform")
+	*w = LFOWaveform(b)
+	return err
+}
+
+type FilterRouting byte
+
+const (
+	RoutingNormal FilterRouting = iota
+	RoutingOsc1Bypass
+	RoutingOsc12Bypass
+)
+
+var filterRoutingNames = []string{
+	"normal",
+	"osc 1 bypass",
+	"osc 1+2 bypass",
+}
+
+func (r FilterRouting) String() string {
+	return enumString(filterRoutingNames, byte(r), "FilterRouting")
+}
+
+func (r FilterRouting) Valid() bool {
+	return enumValid(filterRoutingNames, byte(r))
+}
+
+func (r FilterRouting) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *FilterRouting) UnmarshalText(text []byte) error {
+	b, err := enumParse(filterRoutingNames, text, "FilterRouting")
+	*r = FilterRouting(b)
+	return err
+}
+
+type FilterType byte
+
+const (
+	FilterLowPass12 FilterType = iota
+	FilterLowPass24
+	FilterBandPass6
+	FilterBandPass12
+	FilterHighPass12
+	FilterHighPass24
+)
+
+var filterTypeNames = []string{
+	"low-pass 12dB",
+	"low-pass 24dB",
+	"band-pass 6/6dB",
+	"band-pass 12/12dB",
+	"high-pass 12dB",
+	"high-pass 24dB",
+}
+
+func (t FilterType) String() string {
+	return enumString(filterTypeNames, byte(t), "FilterType")
+}
+
+func (t FilterType) Valid() bool {
+	return enumValid(filterTypeNames, byte(t))
+}
+
+func (t FilterType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *FilterType) UnmarshalText(text []byte) error {
+	b, err := enumParse(filterTypeNames, text, "FilterType")
+	*t = FilterType(b)
+	return err
+}
+
+// DistortionType is shared by the filter drive and the distortion effect.
+type DistortionType byte
+
+const (
+	DistortionDiode DistortionType = iota
+	DistortionValve
+	DistortionClipper
+	DistortionCrossOver
+	DistortionRectifier
+	DistortionBitReducer
+	DistortionRateReducer
+)
+
+var distortionTypeNames = []string{
+	"diode",
+	"valve",
+	"clipper",
+	"cross-over",
+	"rectifier",
+	"bit reducer",
+	"rate reducer",
+}
+
+func (t DistortionType) String() string {
+	return enumString(distortionTypeNames, byte(t), "DistortionType")
+}
+
+func (t DistortionType) Valid() bool {
+	return enumValid(distortionTypeNames, byte(t))
+}
+
+func (t DistortionType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *DistortionType) UnmarshalText(text []byte) error {
+	b, err := enumParse(distortionTypeNames, text, "DistortionType")
+	*t = DistortionType(b)
+	return err
+}
+
+type ChorusType byte
+
+const (
+	ChorusPhaser ChorusType = iota
+	ChorusChorus
+)
+
+var chorusTypeNames = []string{
+	"phaser",
+	"chorus",
+}
+
+func (t ChorusType) String() string {
+	return enumString(chorusTypeNames, byte(t), "ChorusType")
+}
+
+func (t ChorusType) Valid() bool {
+	return enumValid(chorusTypeNames, byte(t))
+}
+
+func (t ChorusType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *ChorusType) UnmarshalText(text []byte) error {
+	b, err := enumParse(chorusTypeNames, text, "ChorusType")
+	*t = ChorusType(b)
+	return err
+}
+
+// SyncRate is a tempo-synchronized rate, expressed as a note length.
+type SyncRate byte
+
+const SyncOff SyncRate = 0
+
+var syncRateNames = []string{
+	"off",
+	"1/32T",
+	"1/32",
+	"1/16T",
+	"1/16",
+	"1/8T",
+	"1/16D",
+	"1/8",
+	"1/4T",
+	"1/8D",
+	"1/4",
+	"1+1/3",
+	"1/4D",
+	"1/2",
+	"2+2/3",
+	"3 beats",
+	"4 beats",
+	"5+1/3",
+	"6 beats",
+	"8 beats",
+	"10+2/3",
+	"12 beats",
+	"13+1/3",
+	"16 beats",
+	"18 beats",
+	"18+2/3",
+	"20 beats",
+	"21+1/3",
+	"24 beats",
+	"28 beats",
+	"30 beats",
+	"32 beats",
+	"36 beats",
+	"42 beats",
+	"48 beats",
+	"64 beats",
+}
+
+func (r SyncRate) String() string {
+	return enumString(syncRateNames, byte(r), "SyncRate")
+}
+
+func (r SyncRate) Valid() bool {
+	return enumValid(syncRateNames, byte(r))
+}
+
+func (r SyncRate) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *SyncRate) UnmarshalText(text []byte) error {
+	b, err := enumParse(syncRateNames, text, "SyncRate")
+	*r = SyncRate(b)
+	return err
+}
+
+type ModSource byte
+
+// Values 1 to 3 are reserved.
+const (
+	ModSourceDirect ModSource = iota
+	_
+	_
+	_
+	ModSourceVelocity
+	ModSourceKeyboard
+	ModSourceLFO1Unipolar
+	ModSourceLFO1Bipolar
+	ModSourceLFO2Unipolar
+	ModSourceLFO2Bipolar
+	ModSourceEnvAmp
+	ModSourceEnvFilter
+	ModSourceEnv3
+)
+
+var modSourceNames = []string{
+	"direct",
+	"",
+	"",
+	"",
+	"velocity",
+	"keyboard",
+	"LFO 1+",
+	"LFO 1+/-",
+	"LFO 2+",
+	"LFO 2+/-",
+	"env amp",
+	"env filter",
+	"env 3",
+}
+
+func (s ModSource) String() string {
+	return enumString(modSourceNames, byte(s), "ModSource")
+}
+
+func (s ModSource) Valid() bool {
+	return enumValid(modSourceNames, byte(s))
+}
+
+func (s ModSource) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *ModSource) UnmarshalText(text []byte) error {
+	b, err := enumParse(modSourceNames, text, "ModSource")
+	*s = ModSource(b)
+	return err
+}
+
+type ModDestination byte
+
+const (
+	ModDestOsc12Pitch ModDestination = iota
+	ModDestOsc1Pitch
+	ModDestOsc2Pitch
+	ModDestOsc1VSync
+	ModDestOsc2VSync
+	ModDestOsc1PulseWidth
+	ModDestOsc2PulseWidth
+	ModDestOsc1Level
+	ModDestOsc2Level
+	ModDestNoiseLevel
+	ModDestRingModLevel
+	ModDestFilterDrive
+	ModDestFilterFrequency
+	ModDestFilterResonance
+	ModDestLFO1Rate
+	ModDestLFO2Rate
+	ModDestAmpEnvDecay
+	ModDestFilterEnvDecay
+)
+
+var modDestinationNames = []string{
+	"osc 1+2 pitch",
+	"osc 1 pitch",
+	"osc 2 pitch",
+	"osc 1 v-sync",
+	"osc 2 v-sync",
+	"osc 1 pulse width/index",
+	"osc 2 pulse width/index",
+	"osc 1 level",
+	"osc 2 level",
+	"noise level",
+	"ring mod 1*2 level",
+	"filter drive amount",
+	"filter frequency",
+	"filter resonance",
+	"LFO 1 rate",
+	"LFO 2 rate",
+	"amp env decay",
+	"filter env decay",
+}
+
+func (d ModDestination) String() string {
+	return enumString(modDestinationNames, byte(d), "ModDestination")
+}
+
+func (d ModDestination) Valid() bool {
+	return enumValid(modDestinationNames, byte(d))
+}
+
+func (d ModDestination) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *ModDestination) UnmarshalText(text []byte) error {
+	b, err := enumParse(modDestinationNames, text, "ModDestination")
+	*d = ModDestination(b)
+	return err
+}
+
+// MacroDestination is a parameter controlled by a macro knob. Destinations
+// 51 to 70 control the depth of the mod matrix slots 1 to 20.
+type MacroDestination byte
+
+const (
+	MacroOff MacroDestination = iota
+	MacroPortamentoRate
+	MacroPostFXLevel
+	MacroOsc1WaveInterpolate
+	MacroOsc1PulseWidthIndex
+	MacroOsc1VSyncDepth
+	MacroOsc1Density
+	MacroOsc1DensityDetune
+	MacroOsc1Semitones
+	MacroOsc1Cents
+	MacroOsc2WaveInterpolate
+	MacroOsc2PulseWidthIndex
+	MacroOsc2VSyncDepth
+	MacroOsc2Density
+	MacroOsc2DensityDetune
+	MacroOsc2Semitones
+	MacroOsc2Cents
+	MacroOsc1Level
+	MacroOsc2Level
+	MacroRingModLevel
+	MacroNoiseLevel
+	MacroFilterFrequency
+	MacroFilterResonance
+	MacroFilterDrive
+	MacroFilterTracking
+	MacroFilterEnv2ToFreq
+	MacroEnv1Attack
+	MacroEnv1Decay
+	MacroEnv1Sustain
+	MacroEnv1Release
+	MacroEnv2Attack
+	MacroEnv2Decay
+	MacroEnv2Sustain
+	MacroEnv2Release
+	MacroEnv3Delay
+	MacroEnv3Attack
+	MacroEnv3Decay
+	MacroEnv3Sustain
+	MacroEnv3Release
+	MacroLFO1Rate
+	MacroLFO1SyncRate
+	MacroLFO1Slew
+	MacroLFO2Rate
+	MacroLFO2SyncRate
+	MacroLFO2Slew
+	MacroDistortionLevel
+	MacroChorusLevel
+	MacroChorusRate
+	MacroChorusFeedback
+	MacroChorusModDepth
+	MacroChorusDelay
+	MacroModMatrix1Depth
+)
+
+var macroDestinationNames = func() []string {
+	names := []string{
+		"off",
+		"portamento rate",
+		"post FX level",
+		"osc 1 wave interpolate",
+		"osc 1 pulse width index",
+		"osc 1 v-sync depth",
+		"osc 1 density",
+		"osc 1 density detune",
+		"osc 1 semitones",
+		"osc 1 cents",
+		"osc 2 wave interpolate",
+		"osc 2 pulse width index",
+		"osc 2 v-sync depth",
+		"osc 2 density",
+		"osc 2 density detune",
+		"osc 2 semitones",
+		"osc 2 cents",
+		"osc 1 level",
+		"osc 2 level",
+		"ring mod level",
+		"noise level",
+		"filter frequency",
+		"filter resonance",
+		"filter drive",
+		"filter tracking",
+		"filter env 2 to freq",
+		"env 1 attack",
+		"env 1 decay",
+		"env 1 sustain",
+		"env 1 release",
+		"env 2 attack",
+		"env 2 decay",
+		"env 2 sustain",
+		"env 2 release",
+		"env 3 delay",
+		"env 3 attack",
+		"env 3 decay",
+		"env 3 sustain",
+		"env 3 release",
+		"LFO 1 rate",
+		"LFO 1 sync rate",
+		"LFO 1 slew",
+		"LFO 2 rate",
+		"LFO 2 sync rate",
+		"LFO 2 slew",
+		"distortion level",
+		"chorus level",
+		"chorus rate",
+		"chorus feedback",
+		"chorus mod depth",
+		"chorus delay",
+	}
+	for i := 1; i <= len(Patch{}.ModMatrix); i++ {
+		names = append(names, fmt.Sprintf("mod matrix %d depth", i))
+	}
+	return names
+}()
+
+func (d MacroDestination) String() string {
+	return enumString(macroDestinationNames, byte(d), "MacroDestination")
+}
+
+func (d MacroDestination) Valid() bool {
+	return enumValid(macroDestinationNames, byte(d))
+}
+
+func (d MacroDestination) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *MacroDestination) UnmarshalText(text []byte) error {
+	b, err := enumParse(macroDestinationNames, text, "MacroDestination")
+	*d = MacroDestination(b)
+	return err
+}
+
+type Genre byte
+
+const (
+	GenreNone Genre = iota
+	GenreClassic
+	GenreBreaks
+	GenreHouse
+	GenreIndustrial
+	GenreJazz
+	GenreHipHop
+	GenrePopRock
+	GenreTechno
+	GenreDubStep
+)
+
+var genreNames = []string{
+	"none",
+	"classic",
+	"breaks",
+	"house",
+	"industrial",
+	"jazz",
+	"hip-hop",
+	"pop/rock",
+	"techno",
+	"dubstep",
+}
+
+func (g Genre) String() string {
+	return enumString(genreNames, byte(g), "Genre")
+}
+
+func (g Genre) Valid() bool {
+	return enumValid(genreNames, byte(g))
+}
+
+func (g Genre) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+func (g *Genre) UnmarshalText(text []byte) error {
+	b, err := enumParse(genreNames, text, "Genre")
+	*g = Genre(b)
+	return err
+}
+
+// ParseGenre returns the genre named s, ignoring case. Unlike UnmarshalText,
+// it rejects numeric values that are not valid genres.
+func ParseGenre(s string) (Genre, error) {
+	var g Genre
+	if err := g.UnmarshalText([]byte(s)); err != nil {
+		return 0, err
+	}
+	if !g.Valid() {
+		return 0, fmt.Errorf("invalid Genre: %q", s)
+	}
+	return g, nil
+}
+
+type Category byte
+
+const (
+	CategoryNone Category = iota
+	CategoryArp
+	CategoryBass
+	CategoryBell
+	CategoryClassic
+	CategoryDrum
+	CategoryKeyboard
+	CategoryLead
+	CategoryMotion
+	CategoryPad
+	CategoryPoly
+	CategorySFX
+	CategoryString
+	CategoryUser
+	CategoryVocal
+)
+
+var categoryNames = []string{
+	"none",
+	"arp",
+	"bass",
+	"bell",
+	"classic",
+	"drum",
+	"keyboard",
+	"lead",
+	"motion",
+	"pad",
+	"poly",
+	"sfx",
+	"string",
+	"user",
+	"vocal",
+}
+
+func (c Category) String() string {
+	return enumString(categoryNames, byte(c), "Category")
+}
+
+func (c Category) Valid() bool {
+	return enumValid(categoryNames, byte(c))
+}
+
+func (c Category) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Category) UnmarshalText(text []byte) error {
+	b, err := enumParse(categoryNames, text, "Category")
+	*c = Category(b)
+	return err
+}
+
+// ParseCategory returns the category named s, ignoring case. Unlike
+// UnmarshalText, it rejects numeric values that are not valid categories.
+func ParseCategory(s string) (Category, error) {
+	var c Category
+	if err := c.UnmarshalText([]byte(s)); err != nil {
+		return 0, err
+	}
+	if !c.Valid() {
+		return 0, fmt.Errorf("invalid Category: %q", s)
+	}
+	return c, nil
+}
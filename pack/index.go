@@ -0,0 +1,73 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+// PatchRef locates a patch in a pack.
+type PatchRef struct {
+	Slot  int
+	Patch *Patch
+}
+
+// PatchFilter selects patches by category and genre. Empty lists match
+// everything.
+type PatchFilter struct {
+	Categories []Category
+	Genres     []Genre
+}
+
+func (f *PatchFilter) match(p *Patch) bool {
+	okCategory := len(f.Categories) == 0
+	for _, c := range f.Categories {
+		okCategory = okCategory || p.Category == c
+	}
+	okGenre := len(f.Genres) == 0
+	for _, g := range f.Genres {
+		okGenre = okGenre || p.Genre == g
+	}
+	return okCategory && okGenre
+}
+
+// FindPatches returns the patches of the pack matching the filter, in slot
+// order. A nil filter matches every patch.
+func (p *Pack) FindPatches(f *PatchFilter) []*PatchRef {
+	if f == nil {
+		f = &PatchFilter{}
+	}
+	var res []*PatchRef
+	for i, patch := range p.Patches {
+		if patch != nil && f.match(patch) {
+			res = append(res, &PatchRef{Slot: i, Patch: patch})
+		}
+	}
+	return res
+}
+
+// PatchesByCategory groups the patches of the pack by category.
+func (p *Pack) PatchesByCategory() map[Category][]*PatchRef {
+	res := make(map[Category][]*PatchRef)
+	for _, ref := range p.FindPatches(nil) {
+		res[ref.Patch.Category] = append(res[ref.Patch.Category], ref)
+	}
+	return res
+}
+
+// PatchesByGenre groups the patches of the pack by genre.
+func (p *Pack) PatchesByGenre() map[Genre][]*PatchRef {
+	res := make(map[Genre][]*PatchRef)
+	for _, ref := range p.FindPatches(nil) {
+		res[ref.Patch.Genre] = append(res[ref.Patch.Genre], ref)
+	}
+	return res
+}
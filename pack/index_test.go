@@ -0,0 +1,89 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCategory(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in   string
+		want Category
+		err  bool
+	}{
+		{in: "bass", want: CategoryBass},
+		{in: "SFX", want: CategorySFX},
+		{in: "Category(9)", want: CategoryPad},
+		{in: "Category(99)", err: true},
+		{in: "kazoo", err: true},
+	} {
+		got, err := ParseCategory(tc.in)
+		if (err != nil) != tc.err {
+			t.Errorf("ParseCategory(%q) error = %v, want error: %t", tc.in, err, tc.err)
+		}
+		if !tc.err && got != tc.want {
+			t.Errorf("ParseCategory(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+	if g, err := ParseGenre("Genre(42)"); err == nil {
+		t.Errorf("ParseGenre(%q) = %v, want error", "Genre(42)", g)
+	}
+	if got, want := GenreHipHop.String(), "hip-hop"; got != want {
+		t.Errorf("GenreHipHop.String() = %q, want %q", got, want)
+	}
+}
+
+func TestFindPatches(t *testing.T) {
+	t.Parallel()
+
+	bass := testPatch("Bass")
+	pad := testPatch("Pad")
+	pad.Category = CategoryPad
+	house := testPatch("House")
+	house.Genre = GenreHouse
+	p := &Pack{Patches: []*Patch{bass, nil, pad, house}}
+
+	slots := func(refs []*PatchRef) []int {
+		var res []int
+		for _, r := range refs {
+			res = append(res, r.Slot)
+		}
+		return res
+	}
+	for _, tc := range []struct {
+		name   string
+		filter *PatchFilter
+		want   []int
+	}{
+		{name: "all", want: []int{0, 2, 3}},
+		{name: "category", filter: &PatchFilter{Categories: []Category{CategoryBass}}, want: []int{0, 3}},
+		{name: "genre", filter: &PatchFilter{Genres: []Genre{GenreTechno}}, want: []int{0, 2}},
+		{name: "both", filter: &PatchFilter{Categories: []Category{CategoryBass, CategoryPad}, Genres: []Genre{GenreHouse}}, want: []int{3}},
+	} {
+		if diff := cmp.Diff(tc.want, slots(p.FindPatches(tc.filter))); diff != "" {
+			t.Errorf("%s: FindPatches() mismatch (-want +got):\n%s", tc.name, diff)
+		}
+	}
+
+	byCategory := p.PatchesByCategory()
+	if got := slots(byCategory[CategoryPad]); !cmp.Equal(got, []int{2}) {
+		t.Errorf("PatchesByCategory()[pad] = %v, want [2]", got)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"fmt"
+)
+
+// macroParams holds the parameter path controlled by each macro destination.
+var macroParams = func() []string {
+	paths := []string{
+		"",
+		"Voice.PortamentoRate",
+		"Mixer.PostFXLevel",
+		"Osc1.WaveInterpolate",
+		"Osc1.PulseWidthIndex",
+		"Osc1.VirtualSyncDepth",
+		"Osc1.Density",
+		"Osc1.DensityDetune",
+		"Osc1.Semitones",
+		"Osc1.Cents",
+		"Osc2.WaveInterpolate",
+		"Osc2.PulseWidthIndex",
+		"Osc2.VirtualSyncDepth",
+		"Osc2.Density",
+		"Osc2.DensityDetune",
+		"Osc2.Semitones",
+		"Osc2.Cents",
+		"Mixer.Osc1Level",
+		"Mixer.Osc2Level",
+		"Mixer.RingModeLevel12",
+		"Mixer.NoiseLevel",
+		"Filter.Frequency",
+		"Filter.Resonance",
+		"Filter.Drive",
+		"Filter.Track",
+		"Filter.Env2ToFreq",
+		"Envelope1.Attack",
+		"Envelope1.Decay",
+		"Envelope1.Sustain",
+		"Envelope1.Release",
+		"Envelope2.Attack",
+		"Envelope2.Decay",
+		"Envelope2.Sustain",
+		"Envelope2.Release",
+		"Envelope3.Delay",
+		"Envelope3.Attack",
+		"Envelope3.Decay",
+		"Envelope3.Sustain",
+		"Envelope3.Release",
+		"LFO1.Rate",
+		"LFO1.RateSync",
+		"LFO1.SlewRate",
+		"LFO2.Rate",
+		"LFO2.RateSync",
+		"LFO2.SlewRate",
+		"DistortionLevel",
+		"ChorusLevel",
+		"Chorus.Rate",
+		"Chorus.Feedback",
+		"Chorus.ModDepth",
+		"Chorus.Delay",
+	}
+	for i := 0; i < len(Patch{}.ModMatrix); i++ {
+		paths = append(paths, fmt.Sprintf("ModMatrix[%d].Depth", i))
+	}
+	return paths
+}()
+
+// Param returns the patch parameter controlled by the destination, or nil
+// for MacroOff and invalid destinations.
+func (d MacroDestination) Param() *Param {
+	if int(d) >= len(macroParams) {
+		return nil
+	}
+	return LookupParam(macroParams[d])
+}
+
+// Targets returns the four targets of the knob, A to D.
+func (k *Knob) Targets() []*KnobTarget {
+	return []*KnobTarget{&k.A, &k.B, &k.C, &k.D}
+}
+
+// Amount returns the signed depth of the target, from -64 to +63.
+func (t KnobTarget) Amount() int {
+	return int(t.Depth) - 64
+}
+
+// apply returns the value of param v once the knob is at pos.
+func (t KnobTarget) apply(param *Param, v, pos byte) byte {
+	if pos < t.Start || t.End < t.Start {
+		return v
+	}
+	frac := 1.0
+	if pos < t.End {
+		frac = float64(pos-t.Start) / float64(t.End-t.Start)
+	}
+	delta := float64(t.Amount()) / 64 * float64(param.Max-param.Min) * frac
+	res := float64(v) + delta
+	if res < float64(param.Min) {
+		return param.Min
+	}
+	if res > float64(param.Max) {
+		return param.Max
+	}
+	return byte(res + 0.5)
+}
+
+func checkMacroKnob(knob int) error {
+	if knob < 0 || knob >= len(Patch{}.Macros) {
+		return fmt.Errorf("invalid macro knob: %d (want 0-%d)", knob, len(Patch{}.Macros)-1)
+	}
+	return nil
+}
+
+func checkMacroSlot(knob, slot int) error {
+	if err := checkMacroKnob(knob); err != nil {
+		return err
+	}
+	if n := len((&Knob{}).Targets()); slot < 0 || slot >= n {
+		return fmt.Errorf("invalid macro slot: %d (want 0-%d)", slot, n-1)
+	}
+	return nil
+}
+
+// AssignMacro sets target slot (0 to 3 for A to D) of macro knob to control
+// dest with the given signed depth while the knob moves from start to end.
+func (p *Patch) AssignMacro(knob, slot int, dest MacroDestination, start, end byte, depth int) error {
+	if err := checkMacroSlot(knob, slot); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("Macros[%d].%c", knob, 'A'+slot)
+	if !dest.Valid() {
+		return &RangeError{Path: path + ".Destination", Value: byte(dest)}
+	}
+	if start > 127 {
+		return &RangeError{Path: path + ".Start", Value: start}
+	}
+	if end > 127 || end < start {
+		return &RangeError{Path: path + ".End", Value: end}
+	}
+	if depth < -64 || depth > 63 {
+		return fmt.Errorf("invalid macro depth: %d (want -64-+63)", depth)
+	}
+	*p.Macros[knob].Targets()[slot] = KnobTarget{
+		Destination: dest,
+		Start:       start,
+		End:         end,
+		Depth:       byte(depth + 64),
+	}
+	return nil
+}
+
+// ClearMacro turns off target slot of macro knob.
+func (p *Patch) ClearMacro(knob, slot int) error {
+	if err := checkMacroSlot(knob, slot); err != nil {
+		return err
+	}
+	*p.Macros[knob].Targets()[slot] = KnobTarget{Depth: 64}
+	return nil
+}
+
+// MacroMapping is an active target of a macro knob.
+type MacroMapping struct {
+	Knob, Slot int
+	Target     KnobTarget
+}
+
+func (m *MacroMapping) String() string {
+	return fmt.Sprintf("macro %d %c: %s %+d from %d to %d",
+		m.Knob+1, 'A'+m.Slot, m.Target.Destination, m.Target.Amount(), m.Target.Start, m.Target.End)
+}
+
+// MacroMappings lists the targets of all macro knobs that are not off.
+func (p *Patch) MacroMappings() []*MacroMapping {
+	var res []*MacroMapping
+	for i := range p.Macros {
+		for j, t := range p.Macros[i].Targets() {
+			if t.Destination == MacroOff {
+				continue
+			}
+			res = append(res, &MacroMapping{Knob: i, Slot: j, Target: *t})
+		}
+	}
+	return res
+}
+
+// MacroValue is the effective value of a parameter controlled by a macro.
+type MacroValue struct {
+	Param *Param
+	Base  byte
+	Value byte
+}
+
+func (v *MacroValue) String() string {
+	return fmt.Sprintf("%s: %s -> %s", v.Param.Path, v.Param.Format(v.Base), v.Param.Format(v.Value))
+}
+
+// EvalMacro returns the effective values of the parameters controlled by the
+// macro knob when it is at pos, in target order. Targets sharing a
+// destination add up.
+func (p *Patch) EvalMacro(knob int, pos byte) ([]*MacroValue, error) {
+	if err := checkMacroKnob(knob); err != nil {
+		return nil, err
+	}
+	var res []*MacroValue
+	values := make(map[string]*MacroValue)
+	for _, t := range p.Macros[knob].Targets() {
+		param := t.Destination.Param()
+		if param == nil {
+			continue
+		}
+		v, ok := values[param.Path]
+		if !ok {
+			base := byte(param.field(p).Uint())
+			v = &MacroValue{Param: param, Base: base, Value: base}
+			values[param.Path] = v
+			res = append(res, v)
+		}
+		v.Value = t.apply(param, v.Value, pos)
+	}
+	return res, nil
+}
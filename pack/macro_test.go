@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMacroParams(t *testing.T) {
+	t.Parallel()
+
+	if got, want := len(macroParams), len(macroDestinationNames); got != want {
+		t.Fatalf("%d macro params, want %d", got, want)
+	}
+	for d := MacroDestination(1); d.Valid(); d++ {
+		if d.Param() == nil {
+			t.Errorf("%v: no parameter", d)
+		}
+	}
+	if MacroOff.Param() != nil {
+		t.Errorf("MacroOff.Param() = %v, want nil", MacroOff.Param())
+	}
+}
+
+func TestEvalMacro(t *testing.T) {
+	t.Parallel()
+
+	p := &Patch{}
+	p.Filter.Frequency = 40
+	p.Mixer.Osc1Level = 100
+	if err := p.AssignMacro(0, 0, MacroFilterFrequency, 0, 127, 32); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AssignMacro(0, 2, MacroOsc1Level, 64, 96, -64); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AssignMacro(0, 3, MacroOsc1Level, 64, 32, 10); err == nil {
+		t.Error("AssignMacro() with end before start succeeded")
+	}
+	if err := p.ClearMacro(0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"macro 1 A: filter frequency +32 from 0 to 127",
+		"macro 1 C: osc 1 level -64 from 64 to 96",
+	}
+	var got []string
+	for _, m := range p.MacroMappings() {
+		got = append(got, m.String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("MacroMappings() mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, tc := range []struct {
+		pos  byte
+		want []byte
+	}{
+		{pos: 0, want: []byte{40, 100}},
+		{pos: 80, want: []byte{80, 37}},
+		{pos: 127, want: []byte{104, 0}},
+	} {
+		values, err := p.EvalMacro(0, tc.pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []byte
+		for _, v := range values {
+			got = append(got, v.Value)
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("EvalMacro(%d) mismatch (-want +got):\n%s", tc.pos, diff)
+		}
+	}
+}
+
+func TestMacroIndexes(t *testing.T) {
+	t.Parallel()
+
+	p := &Patch{}
+	for _, tc := range []struct {
+		knob, slot int
+	}{
+		{knob: -1, slot: 0},
+		{knob: 8, slot: 0},
+		{knob: 0, slot: -1},
+		{knob: 0, slot: 4},
+	} {
+		if err := p.AssignMacro(tc.knob, tc.slot, MacroFilterFrequency, 0, 127, 10); err == nil {
+			t.Errorf("AssignMacro(%d, %d) succeeded, want error", tc.knob, tc.slot)
+		}
+		if err := p.ClearMacro(tc.knob, tc.slot); err == nil {
+			t.Errorf("ClearMacro(%d, %d) succeeded, want error", tc.knob, tc.slot)
+		}
+	}
+	for _, knob := range []int{-1, 8} {
+		if _, err := p.EvalMacro(knob, 0); err == nil {
+			t.Errorf("EvalMacro(%d) succeeded, want error", knob)
+		}
+	}
+}
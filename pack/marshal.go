@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// patchFields has the fields of Patch, but none of its methods.
+type patchFields Patch
+
+// patchDoc is the human-readable representation of a patch. The name is a
+// string, enums use their symbolic names, and everything else, reserved
+// bytes included, is kept as is. Names with bytes outside of printable ASCII
+// are stored as hexadecimal in RawName instead.
+type patchDoc struct {
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	RawName     string `json:"rawName,omitempty" yaml:"rawName,omitempty"`
+	patchFields `yaml:",inline"`
+}
+
+func newPatchDoc(p *Patch) *patchDoc {
+	d := &patchDoc{patchFields: patchFields(*p)}
+	for _, c := range p.PatchName {
+		if c < minNameChar || c > maxNameChar {
+			d.RawName = hex.EncodeToString(p.PatchName[:])
+			return d
+		}
+	}
+	d.Name = strings.TrimRight(string(p.PatchName[:]), " ")
+	return d
+}
+
+func (d *patchDoc) patch() (*Patch, error) {
+	p := Patch(d.patchFields)
+	if d.RawName != "" {
+		name, err := hex.DecodeString(d.RawName)
+		if err != nil {
+			return nil, fmt.Errorf("raw patch name: %w", err)
+		}
+		if n := len(name); n != len(p.PatchName) {
+			return nil, fmt.Errorf("raw patch name: wrong length: %d", n)
+		}
+		copy(p.PatchName[:], name)
+		return &p, nil
+	}
+	if n := len(d.Name); n > len(p.PatchName) {
+		return nil, fmt.Errorf("patch name too long: %d", n)
+	}
+	copy(p.PatchName[:], bytes.Repeat([]byte{' '}, len(p.PatchName)))
+	copy(p.PatchName[:], d.Name)
+	return &p, nil
+}
+
+func (p Patch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newPatchDoc(&p))
+}
+
+func (p *Patch) UnmarshalJSON(data []byte) error {
+	d := &patchDoc{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return err
+	}
+	res, err := d.patch()
+	if err != nil {
+		return err
+	}
+	*p = *res
+	return nil
+}
+
+func (p Patch) MarshalYAML() (interface{}, error) {
+	return newPatchDoc(&p), nil
+}
+
+func (p *Patch) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	d := &patchDoc{}
+	if err := unmarshal(d); err != nil {
+		return err
+	}
+	res, err := d.patch()
+	if err != nil {
+		return err
+	}
+	*p = *res
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPatchMarshal(t *testing.T) {
+	in := testPatch("Bass 1          ")
+	in.Reserved[3] = 0x42
+	in.Osc1.Wave = WaveSawtooth
+	in.Filter.Type = FilterLowPass24
+	in.Chorus.RateSync = SyncOff
+	in.ModMatrix[2].Destination = 42
+
+	data := []struct {
+		name      string
+		marshal   func(interface{}) ([]byte, error)
+		unmarshal func([]byte, interface{}) error
+		want      []string
+	}{
+		{
+			name:      "json",
+			marshal:   json.Marshal,
+			unmarshal: json.Unmarshal,
+			want:      []string{`"name":"Bass 1"`, `"wave":"sawtooth"`, `"type":"low-pass 24dB"`, `"destination":"ModDestination(42)"`, `"polyphonyMode":`},
+		},
+		{
+			name:      "yaml",
+			marshal:   yaml.Marshal,
+			unmarshal: yaml.Unmarshal,
+			want:      []string{"name: Bass 1\n", "wave: sawtooth\n", "type: low-pass 24dB\n", `rateSync: "off"`, "polyphonyMode:", "attack:"},
+		},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			text, err := tt.marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(text), w) {
+					t.Errorf("Marshal() = %s, want it to contain %s", text, w)
+				}
+			}
+
+			out := &Patch{}
+			if err := tt.unmarshal(text, out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(in, out); diff != "" {
+				t.Errorf("Unmarshal() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPatchMarshalRawName(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"Caf\xe9 \xff", "Bass\x00\x00"} {
+		in := testPatch("")
+		copy(in.PatchName[:], name)
+
+		for _, m := range []struct {
+			marshal   func(interface{}) ([]byte, error)
+			unmarshal func([]byte, interface{}) error
+		}{
+			{json.Marshal, json.Unmarshal},
+			{yaml.Marshal, yaml.Unmarshal},
+		} {
+			text, err := m.marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := &Patch{}
+			if err := m.unmarshal(text, out); err != nil {
+				t.Fatalf("Unmarshal(%s) = %v", text, err)
+			}
+			if out.PatchName != in.PatchName {
+				t.Errorf("Unmarshal(%s) name = %q, want %q", text, out.PatchName, in.PatchName)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"errors"
+	"fmt"
+
+	"yrh.dev/circuit/model"
+)
+
+// ModDepthCenter is the raw depth of a mod matrix slot with no effect. Slots
+// at this depth are considered empty.
+const ModDepthCenter = 64
+
+// ErrModMatrixFull is returned when adding a routing to a patch with no
+// empty mod matrix slot left.
+var ErrModMatrixFull = errors.New("mod matrix is full")
+
+type modCatalog struct {
+	sources      []ModSource
+	destinations []ModDestination
+}
+
+// Both synth engines share the same mod matrix.
+var synthModCatalog = &modCatalog{
+	sources: []ModSource{
+		ModSourceDirect,
+		ModSourceVelocity,
+		ModSourceKeyboard,
+		ModSourceLFO1Unipolar,
+		ModSourceLFO1Bipolar,
+		ModSourceLFO2Unipolar,
+		ModSourceLFO2Bipolar,
+		ModSourceEnvAmp,
+		ModSourceEnvFilter,
+		ModSourceEnv3,
+	},
+	destinations: func() []ModDestination {
+		var res []ModDestination
+		for d := range modDestinationNames {
+			res = append(res, ModDestination(d))
+		}
+		return res
+	}(),
+}
+
+var modCatalogs = map[*model.Flavor]*modCatalog{
+	model.Circuit:       synthModCatalog,
+	model.CircuitTracks: synthModCatalog,
+}
+
+// ModSources returns the mod matrix sources available on the flavor.
+func ModSources(f *model.Flavor) []ModSource {
+	if c, ok := modCatalogs[f]; ok {
+		return append([]ModSource(nil), c.sources...)
+	}
+	return nil
+}
+
+// ModDestinations returns the mod matrix destinations available on the
+// flavor.
+func ModDestinations(f *model.Flavor) []ModDestination {
+	if c, ok := modCatalogs[f]; ok {
+		return append([]ModDestination(nil), c.destinations...)
+	}
+	return nil
+}
+
+// Empty reports whether the slot has no effect.
+func (m Mod) Empty() bool {
+	return m.Depth == ModDepthCenter
+}
+
+// Amount returns the signed depth of the routing, from -64 to +63.
+func (m Mod) Amount() int {
+	return int(m.Depth) - ModDepthCenter
+}
+
+func (m Mod) String() string {
+	if m.Empty() {
+		return "-"
+	}
+	src := m.Source1.String()
+	if m.Source2 != ModSourceDirect {
+		src += " * " + m.Source2.String()
+	}
+	return fmt.Sprintf("%s -> %s %+d", src, m.Destination, m.Amount())
+}
+
+// AddMod routes the sources to the destination at the given signed depth in
+// the first empty slot of the mod matrix, and returns the slot index.
+// Source2 is ModSourceDirect for routings with a single source.
+func (p *Patch) AddMod(source1, source2 ModSource, dest ModDestination, depth int) (int, error) {
+	if depth < -ModDepthCenter || depth >= ModDepthCenter {
+		return -1, fmt.Errorf("invalid mod depth: %d (want %d-%+d)", depth, -ModDepthCenter, ModDepthCenter-1)
+	}
+	if depth == 0 {
+		return -1, errors.New("invalid mod depth: 0 leaves the slot empty")
+	}
+	if !source1.Valid() {
+		return -1, &RangeError{Path: "Mod.Source1", Value: byte(source1)}
+	}
+	if !source2.Valid() {
+		return -1, &RangeError{Path: "Mod.Source2", Value: byte(source2)}
+	}
+	if !dest.Valid() {
+		return -1, &RangeError{Path: "Mod.Destination", Value: byte(dest)}
+	}
+	for i := range p.ModMatrix {
+		if !p.ModMatrix[i].Empty() {
+			continue
+		}
+		p.ModMatrix[i] = Mod{
+			Source1:     source1,
+			Source2:     source2,
+			Depth:       byte(depth + ModDepthCenter),
+			Destination: dest,
+		}
+		return i, nil
+	}
+	return -1, ErrModMatrixFull
+}
+
+// RemoveMod clears the slot at index i.
+func (p *Patch) RemoveMod(i int) error {
+	if i < 0 || i >= len(p.ModMatrix) {
+		return fmt.Errorf("invalid mod matrix slot: %d (want 0-%d)", i, len(p.ModMatrix)-1)
+	}
+	p.ModMatrix[i] = Mod{Depth: ModDepthCenter}
+	return nil
+}
+
+// FindMods returns the indexes of the non-empty slots routing source to dest,
+// either as first or second source.
+func (p *Patch) FindMods(source ModSource, dest ModDestination) []int {
+	var res []int
+	for i, m := range p.ModMatrix {
+		if m.Empty() || m.Destination != dest {
+			continue
+		}
+		if m.Source1 == source || m.Source2 == source {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// CompactMods moves the non-empty slots to the front of the mod matrix,
+// keeping their order, and clears the others. Slots whose depth is controlled
+// by a macro are kept even when empty, and the macros follow them.
+func (p *Patch) CompactMods() {
+	used := make([]bool, len(p.ModMatrix))
+	for i, m := range p.ModMatrix {
+		used[i] = !m.Empty()
+	}
+	var targets []*KnobTarget
+	for i := range p.Macros {
+		for _, t := range p.Macros[i].Targets() {
+			if slot := int(t.Destination) - int(MacroModMatrix1Depth); slot >= 0 && slot < len(used) {
+				used[slot] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+
+	moved := make([]int, len(p.ModMatrix))
+	n := 0
+	for i, m := range p.ModMatrix {
+		if used[i] {
+			p.ModMatrix[n] = m
+			moved[i] = n
+			n++
+		}
+	}
+	for ; n < len(p.ModMatrix); n++ {
+		p.ModMatrix[n] = Mod{Depth: ModDepthCenter}
+	}
+	for _, t := range targets {
+		t.Destination = MacroModMatrix1Depth + MacroDestination(moved[t.Destination-MacroModMatrix1Depth])
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"yrh.dev/circuit/model"
+)
+
+func emptyModMatrix() *Patch {
+	p := &Patch{}
+	for i := range p.ModMatrix {
+		p.ModMatrix[i] = Mod{Depth: ModDepthCenter}
+	}
+	return p
+}
+
+func TestAddMod(t *testing.T) {
+	t.Parallel()
+
+	p := emptyModMatrix()
+	i, err := p.AddMod(ModSourceLFO1Bipolar, ModSourceDirect, ModDestOsc1Pitch, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Mod{Source1: ModSourceLFO1Bipolar, Depth: 84, Destination: ModDestOsc1Pitch}
+	if diff := cmp.Diff(want, p.ModMatrix[i]); diff != "" {
+		t.Errorf("AddMod() mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := p.ModMatrix[i].String(), "LFO 1+/- -> osc 1 pitch +20"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		src   ModSource
+		dest  ModDestination
+		depth int
+	}{
+		{name: "depth", src: ModSourceVelocity, depth: 64},
+		{name: "zero depth", src: ModSourceVelocity, depth: 0},
+		{name: "source", src: 2, depth: 10},
+		{name: "destination", src: ModSourceVelocity, dest: 18, depth: 10},
+	} {
+		if _, err := p.AddMod(tc.src, ModSourceDirect, tc.dest, tc.depth); err == nil {
+			t.Errorf("%s: AddMod() succeeded, want error", tc.name)
+		}
+	}
+
+	for range p.ModMatrix[1:] {
+		if _, err := p.AddMod(ModSourceVelocity, ModSourceDirect, ModDestFilterFrequency, -1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.AddMod(ModSourceVelocity, ModSourceDirect, ModDestFilterFrequency, -1); err != ErrModMatrixFull {
+		t.Errorf("AddMod() on a full matrix = %v, want %v", err, ErrModMatrixFull)
+	}
+	if _, err := p.AddMod(2, ModSourceDirect, ModDestFilterFrequency, -1); err == nil || err == ErrModMatrixFull {
+		t.Errorf("AddMod() on a full matrix with an invalid source = %v, want a range error", err)
+	}
+}
+
+func TestFindAndCompactMods(t *testing.T) {
+	t.Parallel()
+
+	p := emptyModMatrix()
+	p.ModMatrix[3] = Mod{Source1: ModSourceVelocity, Source2: ModSourceEnv3, Depth: 70, Destination: ModDestFilterFrequency}
+	p.ModMatrix[7] = Mod{Source1: ModSourceEnv3, Depth: 10, Destination: ModDestFilterFrequency}
+	p.ModMatrix[9] = Mod{Source1: ModSourceEnv3, Depth: 10, Destination: ModDestOsc2Level}
+
+	if diff := cmp.Diff([]int{3, 7}, p.FindMods(ModSourceEnv3, ModDestFilterFrequency)); diff != "" {
+		t.Errorf("FindMods() mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := p.RemoveMod(7); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{-1, len(p.ModMatrix)} {
+		if err := p.RemoveMod(i); err == nil {
+			t.Errorf("RemoveMod(%d) succeeded, want error", i)
+		}
+	}
+	p.CompactMods()
+	want := emptyModMatrix()
+	want.ModMatrix[0] = Mod{Source1: ModSourceVelocity, Source2: ModSourceEnv3, Depth: 70, Destination: ModDestFilterFrequency}
+	want.ModMatrix[1] = Mod{Source1: ModSourceEnv3, Depth: 10, Destination: ModDestOsc2Level}
+	if diff := cmp.Diff(want.ModMatrix, p.ModMatrix); diff != "" {
+		t.Errorf("CompactMods() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestModCatalog(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range []*model.Flavor{model.Circuit, model.CircuitTracks} {
+		for _, s := range ModSources(f) {
+			if !s.Valid() {
+				t.Errorf("%s: invalid source %v", f.Name, s)
+			}
+		}
+		if got, want := len(ModDestinations(f)), 18; got != want {
+			t.Errorf("%s: %d destinations, want %d", f.Name, got, want)
+		}
+	}
+}
+
+func TestCompactModsMacros(t *testing.T) {
+	t.Parallel()
+
+	p := emptyModMatrix()
+	p.ModMatrix[0] = Mod{Source1: ModSourceVelocity, Depth: 70, Destination: ModDestFilterFrequency}
+	p.ModMatrix[1] = Mod{Source1: ModSourceEnv3, Depth: 10, Destination: ModDestOsc2Level}
+	p.ModMatrix[4] = Mod{Source1: ModSourceLFO1Bipolar, Depth: ModDepthCenter, Destination: ModDestOsc1Pitch}
+	if err := p.AssignMacro(0, 0, MacroModMatrix1Depth+1, 0, 127, 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AssignMacro(1, 0, MacroModMatrix1Depth+4, 0, 127, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.RemoveMod(0); err != nil {
+		t.Fatal(err)
+	}
+	p.CompactMods()
+
+	want := emptyModMatrix()
+	want.ModMatrix[0] = Mod{Source1: ModSourceEnv3, Depth: 10, Destination: ModDestOsc2Level}
+	want.ModMatrix[1] = Mod{Source1: ModSourceLFO1Bipolar, Depth: ModDepthCenter, Destination: ModDestOsc1Pitch}
+	if diff := cmp.Diff(want.ModMatrix, p.ModMatrix); diff != "" {
+		t.Errorf("CompactMods() mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := p.Macros[0].A.Destination, MacroModMatrix1Depth; got != want {
+		t.Errorf("macro 1 destination = %v, want %v", got, want)
+	}
+	if got, want := p.Macros[1].A.Destination, MacroModMatrix1Depth+1; got != want {
+		t.Errorf("macro 2 destination = %v, want %v", got, want)
+	}
+}
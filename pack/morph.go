@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import "math"
+
+// morphThreshold is the position at which discrete parameters switch from the
+// first patch to the second one.
+const morphThreshold = 0.5
+
+// Morph returns a patch between a and b, at position t (0 is a, 1 is b).
+// Continuous parameters are interpolated linearly, while discrete ones, as
+// well as the name and reserved bytes, switch from a to b half way. A nil
+// patch is an empty slot, morphed as InitPatch. Positions outside of [0, 1]
+// are clamped, and NaN is taken as 0.
+func Morph(a, b *Patch, t float64) *Patch {
+	if math.IsNaN(t) {
+		t = 0
+	}
+	t = math.Max(0, math.Min(1, t))
+	if a == nil {
+		a = InitPatch()
+	}
+	if b == nil {
+		b = InitPatch()
+	}
+
+	res := *a
+	if t >= morphThreshold {
+		res = *b
+	}
+
+	for _, param := range params {
+		if param.Discrete {
+			continue
+		}
+		va, vb := float64(param.field(a).Uint()), float64(param.field(b).Uint())
+		param.field(&res).SetUint(uint64(math.Round(va + (vb-va)*t)))
+	}
+	return &res
+}
+
+// MorphBank returns n patches going from a to b in even steps, both included.
+// It returns nil when n is not positive.
+func MorphBank(a, b *Patch, n int) []*Patch {
+	if n <= 0 {
+		return nil
+	}
+	bank := make([]*Patch, n)
+	for i := range bank {
+		t := 0.0
+		if n > 1 {
+			t = float64(i) / float64(n-1)
+		}
+		bank[i] = Morph(a, b, t)
+	}
+	return bank
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMorph(t *testing.T) {
+	a := testPatch("A")
+	b := testPatch("B")
+	a.Filter.Frequency, b.Filter.Frequency = 0, 100
+	a.Osc1.Wave, b.Osc1.Wave = WaveSine, WaveSquare
+
+	data := []struct {
+		t         float64
+		name      string
+		frequency byte
+		wave      Waveform
+	}{
+		{t: 0, name: "A", frequency: 0, wave: WaveSine},
+		{t: 0.25, name: "A", frequency: 25, wave: WaveSine},
+		{t: 0.5, name: "B", frequency: 50, wave: WaveSquare},
+		{t: 1, name: "B", frequency: 100, wave: WaveSquare},
+		{t: 2, name: "B", frequency: 100, wave: WaveSquare},
+		{t: math.NaN(), name: "A", frequency: 0, wave: WaveSine},
+	}
+
+	for _, tt := range data {
+		p := Morph(a, b, tt.t)
+		if p.Name() != tt.name || p.Filter.Frequency != tt.frequency || p.Osc1.Wave != tt.wave {
+			t.Errorf("Morph(%v) = %s/%d/%s, want %s/%d/%s", tt.t,
+				p.Name(), p.Filter.Frequency, p.Osc1.Wave,
+				tt.name, tt.frequency, tt.wave)
+		}
+	}
+
+	if n := len(MorphBank(a, b, 128)); n != 128 {
+		t.Errorf("MorphBank() = %d patches, want 128", n)
+	}
+	if bank := MorphBank(a, b, -1); bank != nil {
+		t.Errorf("MorphBank(-1) = %d patches, want nil", len(bank))
+	}
+}
+
+func TestMorphNil(t *testing.T) {
+	t.Parallel()
+	a := testPatch("A")
+	a.Filter.Frequency = 100
+
+	p := Morph(a, nil, 0.5)
+	if want := byte((100 + int(InitPatch().Filter.Frequency) + 1) / 2); p.Filter.Frequency != want {
+		t.Errorf("Morph().Filter.Frequency = %d, want %d", p.Filter.Frequency, want)
+	}
+	if p := Morph(nil, nil, 0); *p != *InitPatch() {
+		t.Errorf("Morph(nil, nil) = %v, want init patch", p)
+	}
+}
@@ -17,14 +17,12 @@ package pack
 import (
 	"archive/zip"
 	"bytes"
+	stdbinary "encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
 	"io"
-	"io/ioutil"
 
-	"github.com/go-audio/wav"
-	"github.com/orcaman/writerseeker"
-	"gitlab.com/gomidi/midi/reader"
 	"yrh.dev/circuit/internal/binary"
 	"yrh.dev/circuit/internal/encoding"
 	"yrh.dev/circuit/model"
@@ -51,9 +49,28 @@ func (p *Pack) Write(w io.Writer, f *model.Flavor) error {
 	if n := len(p.Patches); n > f.NumberPatches {
 		return fmt.Errorf("too many patches: %d", n)
 	}
+	if l := projectLayouts[f]; l != nil {
+		for _, project := range p.Projects {
+			if err := project.checkSize(l); err != nil {
+				return err
+			}
+		}
+	}
+	if f.SampleMemory > 0 {
+		u, err := p.SampleUsage(f)
+		if err != nil {
+			return err
+		}
+		if u.Remaining() < 0 {
+			return &SampleMemoryError{Usage: u}
+		}
+	}
 
-	if f == model.CircuitTracks {
+	switch f {
+	case model.CircuitTracks:
 		return p.writeCircuitTracks(w)
+	case model.Circuit:
+		return p.writeCircuit(w)
 	}
 
 	return fmt.Errorf("unsupported flavor: %s", f.Name)
@@ -75,10 +92,10 @@ func (p *Pack) Read(r io.Reader) error {
 	}
 
 	if c == 0x50 {
-		return fmt.Errorf("unsupported input format: %s", model.CircuitTracks.Name)
+		return p.readCircuitTracks(buf.Bytes())
 	}
 
-	return p.readCircuit(buf)
+	return p.readCircuit(buf.Bytes())
 }
 
 type packIndex struct {
@@ -117,16 +134,24 @@ func (p *Pack) writeCircuitTracks(w io.Writer) error {
 
 		project := &Project{}
 
+		if i < len(p.Projects) && p.Projects[i] != nil {
+			project = p.Projects[i]
+		}
+
 		idx.Projects = append(idx.Projects, &packObject{
-			Name: "",
+			Name: project.Name,
 			Path: fname,
 		})
 
+		data, err := project.Format(&ProjectConfig{Flavor: f})
+		if err != nil {
+			return err
+		}
 		w, err := zw.Create(fname)
 		if err != nil {
 			return err
 		}
-		if _, err := w.Write(project.Format(&ProjectConfig{Flavor: f})); err != nil {
+		if _, err := w.Write(data); err != nil {
 			return err
 		}
 	}
@@ -140,7 +165,7 @@ func (p *Pack) writeCircuitTracks(w io.Writer) error {
 
 		sample := &Sample{}
 
-		if i < len(p.Samples) {
+		if i < len(p.Samples) && p.Samples[i] != nil {
 			sample = p.Samples[i]
 		}
 
@@ -149,13 +174,12 @@ func (p *Pack) writeCircuitTracks(w io.Writer) error {
 			Path: fname,
 		})
 
-		// TODO: normalize wav format if needed
-		if sample.Data != nil {
-			w, err := zw.Create(fname)
+		if !sample.Empty() {
+			data, err := sample.deviceWAV(f)
 			if err != nil {
-				return err
+				return fmt.Errorf("sample %q: %w", sample.Name, err)
 			}
-			data, err := ioutil.ReadAll(sample.Data)
+			w, err := zw.Create(fname)
 			if err != nil {
 				return err
 			}
@@ -212,66 +236,304 @@ func (p *Pack) writeCircuitTracks(w io.Writer) error {
 	return nil
 }
 
-func (p *Pack) readCircuit(r io.Reader) error {
-	samplePrefix := model.Circuit.SysExSamplePrefix()
-	patchPrefix := model.Circuit.SysExPatchPrefix()
-	var readErr error
+// samplesSectionID identifies the samples section among the 0x77 sysex
+// commands.
+var samplesSectionID = []byte{0x00, 0x23, 0xb0, 0x00}
 
-	syxReader := func(_ *reader.Position, data []byte) {
-		if bytes.Equal(samplePrefix, data[:len(samplePrefix)]) {
-			readErr = p.readSysexData(data[len(samplePrefix):])
-		} else if bytes.Equal(patchPrefix, data[:len(patchPrefix)]) {
-			p.Patches = append(p.Patches, NewPatch(data))
+// sampleChunkSize is the number of raw bytes carried by each 0x79 sysex
+// message.
+const sampleChunkSize = 7 * 64
+
+func writeSysex(w io.Writer, data ...[]byte) error {
+	msg := []byte{0xf0}
+	for _, d := range data {
+		msg = append(msg, d...)
+	}
+	msg = append(msg, 0xf7)
+	_, err := w.Write(msg)
+	return err
+}
+
+func (p *Pack) writeCircuit(w io.Writer) error {
+	f := model.Circuit
+
+	// TODO: write the sessions section once projects can be converted.
+	if len(p.Projects) > 0 {
+		return fmt.Errorf("writing projects is not supported for %s", f.Name)
+	}
+
+	if len(p.Samples) > 0 {
+		if err := p.writeSysexSamples(w); err != nil {
+			return err
 		}
 	}
 
-	midiReader := reader.New(reader.SysEx(syxReader), reader.NoLogger())
+	// Empty slots are written as init patches to keep the following patches
+	// in place.
+	for i, patch := range p.Patches {
+		if err := writeSysex(w, patch.Format(&PatchConfig{Flavor: f, Index: byte(i)})); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Pack) formatSamples() ([]byte, error) {
+	f := model.Circuit
+	raw := new(bytes.Buffer)
+	raw.WriteByte(byte(len(p.Samples)))
 
-	if err := reader.ReadAllFrom(midiReader, r); err != nil && err != io.EOF {
+	for _, sample := range p.Samples {
+		channels, bits, rate := f.SampleChannels, f.SampleBitDepth, f.SampleRate
+		var frames []int
+
+		if !sample.Empty() {
+			pcm, err := sample.devicePCM(f)
+			if err != nil {
+				return nil, fmt.Errorf("sample %q: %w", sample.Name, err)
+			}
+			frames = pcm.ints()
+		}
+
+		size := bits / 8
+		raw.WriteByte(byte(channels))
+		raw.WriteByte(byte(bits))
+		_ = stdbinary.Write(raw, stdbinary.LittleEndian, uint32(rate))
+		_ = stdbinary.Write(raw, stdbinary.LittleEndian, uint32(len(frames)*size))
+
+		for _, v := range frames {
+			for i := size - 1; i >= 0; i-- {
+				raw.WriteByte(byte(v >> (8 * i)))
+			}
+		}
+	}
+
+	return raw.Bytes(), nil
+}
+
+func (p *Pack) writeSysexSamples(w io.Writer) error {
+	prefix := model.Circuit.SysExSamplePrefix()
+
+	raw, err := p.formatSamples()
+	if err != nil {
+		return err
+	}
+
+	crc := make([]byte, 4)
+	stdbinary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(raw))
+
+	header := new(bytes.Buffer)
+	_, _ = encoding.NewNybbleWriter(header).Write(samplesSectionID)
+	if err := writeSysex(w, prefix, []byte{0x77}, header.Bytes()); err != nil {
 		return err
 	}
 
-	return readErr
+	for len(raw) > 0 {
+		n := sampleChunkSize
+		if n > len(raw) {
+			n = len(raw)
+		}
+		chunk := new(bytes.Buffer)
+		lw := encoding.NewLow7Writer(chunk)
+		_, _ = lw.Write(raw[:n])
+		_ = lw.Flush()
+		if err := writeSysex(w, prefix, []byte{0x79}, chunk.Bytes()); err != nil {
+			return err
+		}
+		raw = raw[n:]
+	}
+
+	footer := new(bytes.Buffer)
+	_, _ = encoding.NewNybbleWriter(footer).Write(crc)
+	return writeSysex(w, prefix, []byte{0x7a}, footer.Bytes())
 }
 
+func (p *Pack) readCircuitTracks(data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	idxFile, ok := files["index.json"]
+	if !ok {
+		return fmt.Errorf("missing index.json in %s pack", model.CircuitTracks.Name)
+	}
+	body, err := readZipFile(idxFile)
+	if err != nil {
+		return err
+	}
+	idx := &packIndex{}
+	if err := json.Unmarshal(body, idx); err != nil {
+		return err
+	}
+
+	p.Name = idx.Name
+	p.Color = idx.Color
+
+	for _, obj := range idx.Projects {
+		project := &Project{
+			Name: obj.Name,
+		}
+		if f, ok := files[obj.Path]; ok {
+			data, err := readZipFile(f)
+			if err != nil {
+				return err
+			}
+			project.Data = data
+		}
+		p.Projects = append(p.Projects, project)
+	}
+
+	for _, obj := range idx.Samples {
+		sample := &Sample{
+			Name: obj.Name,
+		}
+		if f, ok := files[obj.Path]; ok {
+			data, err := readZipFile(f)
+			if err != nil {
+				return err
+			}
+			sample.wav = data
+		}
+		p.Samples = append(p.Samples, sample)
+	}
+
+	for _, obj := range idx.Patches {
+		f, ok := files[obj.Path]
+		if !ok {
+			p.Patches = append(p.Patches, nil)
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return err
+		}
+		patch, _, err := ParsePatch(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", obj.Path, err)
+		}
+		if patch.isInit() {
+			patch = nil
+		}
+		p.Patches = append(p.Patches, patch)
+	}
+
+	return nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// MessageError locates a sysex message of a pack that could not be decoded.
+type MessageError struct {
+	Offset int
+	Err    error
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("sysex message at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+func (p *Pack) readCircuit(data []byte) error {
+	samplePrefix := model.Circuit.SysExSamplePrefix()
+
+	for offset := 0; offset < len(data); {
+		size := bytes.IndexByte(data[offset:], 0xf7) + 1
+		if data[offset] != 0xf0 || size == 0 {
+			return &MessageError{Offset: offset, Err: ErrFraming}
+		}
+		msg := data[offset : offset+size]
+
+		if body := msg[1 : len(msg)-1]; bytes.HasPrefix(body, samplePrefix) {
+			if err := p.readSysexData(body[len(samplePrefix):]); err != nil {
+				return &MessageError{Offset: offset, Err: err}
+			}
+		} else {
+			patch, _, err := ParsePatch(msg)
+			if err != nil {
+				return &MessageError{Offset: offset, Err: err}
+			}
+			if patch.isInit() {
+				patch = nil
+			}
+			p.Patches = append(p.Patches, patch)
+		}
+
+		offset += size
+	}
+
+	return nil
+}
+
+// sampleHeaderSize is the size of the channels, bits, rate and length that
+// start each sample.
+const sampleHeaderSize = 10
+
 func (p *Pack) parseSamples(crc uint32) error {
 	r := binary.Reader(p.rawSamples)
 	if err := r.CheckCRC(crc); err != nil {
 		return err
 	}
+	if len(r) == 0 {
+		return ErrLength
+	}
 	n := int(r.Uint8())
 	for i := 0; i < n; i++ {
+		if len(r) < sampleHeaderSize {
+			return fmt.Errorf("sample %d: %w", i, ErrLength)
+		}
 		channels := r.Uint8()
 		bits := r.Uint8()
 		rate := r.LittleEndian().Uint32()
-
-		writer := &writerseeker.WriterSeeker{}
-
-		e := wav.NewEncoder(writer,
-			int(rate),
-			int(bits),
-			int(channels),
-			1)
-		defer e.Close()
+		pcm := &PCM{
+			SampleRate: int(rate),
+			Channels:   int(channels),
+			BitDepth:   int(bits),
+		}
+		if err := pcm.checkFormat(); err != nil {
+			return fmt.Errorf("sample %d: %w", i, err)
+		}
 
 		length := r.LittleEndian().Uint32()
+		if int64(length) > int64(len(r)) {
+			return fmt.Errorf("sample %d: %w", i, ErrLength)
+		}
 		size := uint32(bits / 8)
 		nframes := length / size
 		s := r.Section(int(length))
 
-		for f := 0; f < int(nframes); f++ {
-			frame := make([]byte, size)
+		data := make([]int, nframes)
+		for f := range data {
+			var v uint32
 			for i := 0; i < int(size); i++ {
-				frame[int(size)-i-1] = s.Uint8()
+				v = v<<8 | uint32(s.Uint8())
 			}
-			if err := e.WriteFrame(frame); err != nil {
-				return err
+			data[f] = int(v)
+			if shift := 32 - bits; bits > 8 {
+				data[f] = int(int32(v<<shift) >> shift)
 			}
 		}
 
-		sample := &Sample{
-			Name: "",
-			Data: writer.Reader(),
+		pcm.setInts(data)
+		sample := &Sample{}
+		if nframes > 0 {
+			sample.pcm = pcm
 		}
 		p.Samples = append(p.Samples, sample)
 	}
@@ -279,8 +541,16 @@ func (p *Pack) parseSamples(crc uint32) error {
 }
 
 func (p *Pack) readSysexData(data []byte) error {
+	if len(data) == 0 {
+		return ErrLength
+	}
+	// Commands 0x77 and 0x7a carry 8 nybbles. Slicing past the end of a
+	// short message would read the next one.
 	switch cmd := data[0]; cmd {
 	case 0x77:
+		if len(data) < 9 {
+			return ErrLength
+		}
 		// TODO: allocate the full unpacked slice here
 		// We have potentially 2 sections sharing the same sysex command:
 		// - the sessions one
@@ -304,6 +574,9 @@ func (p *Pack) readSysexData(data []byte) error {
 			p.rawSamples = append(p.rawSamples, chunk...)
 		}
 	case 0x7a:
+		if len(data) < 9 {
+			return ErrLength
+		}
 		if p.inSamples {
 			r := encoding.NewNybbleReader((bytes.NewBuffer(data[1:9])))
 			body, err := io.ReadAll(r)
@@ -0,0 +1,237 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"testing"
+
+	"github.com/go-audio/wav"
+	"github.com/google/go-cmp/cmp"
+	"yrh.dev/circuit/model"
+)
+
+func testPatch(name string) *Patch {
+	p := &Patch{
+		Category: CategoryBass,
+		Genre:    GenreTechno,
+	}
+	_ = p.SetName(name)
+	p.Filter.Frequency = 42
+	return p
+}
+
+func testWAV(t *testing.T, data []int) []byte {
+	t.Helper()
+	return encodeTestWAV(t, 48000, 16, 1, wavFormatPCM, data)
+}
+
+func testPCMSample(t *testing.T, name string, p *PCM) *Sample {
+	t.Helper()
+	s, err := NewPCMSample(name, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func readWAV(t *testing.T, s *Sample) []int {
+	t.Helper()
+
+	data, err := s.WAV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := wav.NewDecoder(bytes.NewReader(data)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Data
+}
+
+func TestCircuitRoundTrip(t *testing.T) {
+	// Enough data to span several sysex chunks.
+	frames := make([]int, 1000)
+	for i := range frames {
+		frames[i] = (i*97)%65536 - 32768
+	}
+
+	in := &Pack{
+		Samples: []*Sample{
+			NewSample("", testWAV(t, frames)),
+			{},
+			NewSample("", testWAV(t, []int{1, -1, 256, -256})),
+		},
+		Patches: []*Patch{
+			testPatch("Bass 1          "),
+			nil,
+			testPatch("Bass 2          "),
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := in.Write(buf, model.Circuit); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &Pack{}
+	if err := out.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(in.Patches, out.Patches); diff != "" {
+		t.Errorf("Read() patches mismatch (-want +got):\n%s", diff)
+	}
+	if n := len(out.Samples); n != 3 {
+		t.Fatalf("Read() got %d samples, want 3", n)
+	}
+	if diff := cmp.Diff(frames, readWAV(t, out.Samples[0])); diff != "" {
+		t.Errorf("Read() sample mismatch (-want +got):\n%s", diff)
+	}
+	if !out.Samples[1].Empty() {
+		t.Errorf("Read() empty sample slot has data")
+	}
+	if diff := cmp.Diff([]int{1, -1, 256, -256}, readWAV(t, out.Samples[2])); diff != "" {
+		t.Errorf("Read() sample mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCircuitTracksRoundTrip(t *testing.T) {
+	project := make([]byte, projectLayouts[model.CircuitTracks].size)
+	copy(project, emptyProject)
+	project[len(project)-1] = 0x42
+
+	kick := testWAV(t, []int{0, 1000, -1000, 0})
+
+	in := &Pack{
+		Name:  "test",
+		Color: "#ff0000",
+		Projects: []*Project{
+			NewProject("song", project),
+		},
+		Samples: []*Sample{
+			NewSample("kick", kick),
+		},
+		Patches: []*Patch{
+			testPatch("Bass 1          "),
+			testPatch("Bass 2          "),
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := in.Write(buf, model.CircuitTracks); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &Pack{}
+	if err := out.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Name != in.Name || out.Color != in.Color {
+		t.Errorf("Read() pack = %q/%q, want %q/%q", out.Name, out.Color, in.Name, in.Color)
+	}
+	if n := len(out.Projects); n != model.CircuitTracks.NumberProjects {
+		t.Fatalf("Read() got %d projects, want %d", n, model.CircuitTracks.NumberProjects)
+	}
+	if diff := cmp.Diff(in.Projects[0], out.Projects[0]); diff != "" {
+		t.Errorf("Read() project mismatch (-want +got):\n%s", diff)
+	}
+	if n := len(out.Samples); n != model.CircuitTracks.NumberSamples {
+		t.Fatalf("Read() got %d samples, want %d", n, model.CircuitTracks.NumberSamples)
+	}
+	if out.Samples[0].Name != "kick" {
+		t.Errorf("Read() sample name = %q, want %q", out.Samples[0].Name, "kick")
+	}
+	data, err := out.Samples[0].WAV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(kick, data); diff != "" {
+		t.Errorf("Read() sample mismatch (-want +got):\n%s", diff)
+	}
+	if !out.Samples[1].Empty() {
+		t.Errorf("Read() empty sample slot has data")
+	}
+	if n := len(out.Patches); n != model.CircuitTracks.NumberPatches {
+		t.Fatalf("Read() got %d patches, want %d", n, model.CircuitTracks.NumberPatches)
+	}
+	if diff := cmp.Diff(in.Patches, out.Patches[:len(in.Patches)]); diff != "" {
+		t.Errorf("Read() patches mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteBadProjectSize(t *testing.T) {
+	t.Parallel()
+
+	p := &Pack{
+		Projects: []*Project{NewProject("short", make([]byte, 100))},
+	}
+	buf := new(bytes.Buffer)
+	if err := p.Write(buf, model.CircuitTracks); !errors.Is(err, ErrLength) {
+		t.Errorf("Write() = %v, want %v", err, ErrLength)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Write() wrote %d bytes before failing", buf.Len())
+	}
+}
+
+func TestWriteCircuitProjects(t *testing.T) {
+	t.Parallel()
+
+	p := &Pack{Projects: []*Project{NewProject("song", nil)}}
+	if err := p.Write(new(bytes.Buffer), model.Circuit); err == nil {
+		t.Error("Write() of projects to a Circuit pack succeeded, want error")
+	}
+}
+
+func TestReadMalformedSamples(t *testing.T) {
+	t.Parallel()
+
+	prefix := model.Circuit.SysExSamplePrefix()
+	frame := func(body ...byte) []byte {
+		return append(append(append([]byte{0xf0}, prefix...), body...), 0xf7)
+	}
+	next := frame(0x77, 0, 0, 2, 3, 0xb, 0, 0, 0)
+
+	for _, tc := range []struct {
+		name string
+		msg  []byte
+	}{
+		{name: "no command", msg: frame()},
+		{name: "short 0x77", msg: frame(0x77, 1, 2)},
+		{name: "short 0x7a", msg: frame(0x7a, 1, 2)},
+	} {
+		p := &Pack{}
+		err := p.Read(bytes.NewReader(append(append([]byte(nil), tc.msg...), next...)))
+		var msgErr *MessageError
+		if !errors.As(err, &msgErr) || msgErr.Offset != 0 || !errors.Is(err, ErrLength) {
+			t.Errorf("%s: Read() = %v, want a MessageError at offset 0 with %v", tc.name, err, ErrLength)
+		}
+	}
+
+	for _, raw := range [][]byte{
+		{},
+		{1, 1, 16},
+		{1, 1, 16, 0x80, 0xbb, 0, 0, 0xff, 0, 0, 0, 1, 2},
+	} {
+		p := &Pack{rawSamples: raw}
+		if err := p.parseSamples(crc32.ChecksumIEEE(raw)); !errors.Is(err, ErrLength) {
+			t.Errorf("parseSamples(%x) = %v, want %v", raw, err, ErrLength)
+		}
+	}
+}
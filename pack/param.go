@@ -0,0 +1,343 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Param describes a single patch parameter, and its legal range of raw
+// values.
+type Param struct {
+	// Path locates the parameter in a Patch, e.g. "ModMatrix[4].Destination".
+	Path string
+	// Min and Max bound the raw value, inclusively.
+	Min, Max byte
+	// Center is the raw value displayed as zero for bipolar parameters, and
+	// 0 otherwise.
+	Center byte
+	// Unit of the displayed value, if any.
+	Unit string
+	// Discrete parameters select between options (waveforms, routings...)
+	// rather than set an amount.
+	Discrete bool
+
+	typ   reflect.Type
+	index []int
+}
+
+type enum interface {
+	fmt.Stringer
+	Valid() bool
+}
+
+type paramRange struct {
+	min, max, center byte
+	unit             string
+	discrete         bool
+}
+
+func enumRange(names []string) paramRange {
+	return paramRange{max: byte(len(names) - 1), discrete: true}
+}
+
+var (
+	bipolar     = paramRange{max: 127, center: 64}
+	semitones   = paramRange{max: 127, center: 64, unit: "semitones"}
+	semitones12 = paramRange{min: 52, max: 76, center: 64, unit: "semitones"}
+	fxLevel     = paramRange{min: 52, max: 82, center: 64, unit: "dB"}
+)
+
+// paramRanges holds the ranges of parameters that don't span 0-127. They are
+// indexed by the name of the enclosing type and field.
+var paramRanges = map[string]paramRange{
+	"Patch.Category":             enumRange(categoryNames),
+	"Patch.Genre":                enumRange(genreNames),
+	"Voice.PolyphonyMode":        enumRange(polyphonyModeNames),
+	"Voice.PreGlide":             semitones12,
+	"Voice.KeyboardOctave":       {min: 58, max: 69, center: 64, unit: "octaves"},
+	"Oscillator.Wave":            enumRange(waveformNames),
+	"Oscillator.PulseWidthIndex": bipolar,
+	"Oscillator.Semitones":       semitones,
+	"Oscillator.Cents":           {max: 127, center: 64, unit: "cents"},
+	"Oscillator.PitchBend":       semitones12,
+	"Mixer.PreFXLevel":           fxLevel,
+	"Mixer.PostFXLevel":          fxLevel,
+	"Filter.Routing":             enumRange(filterRoutingNames),
+	"Filter.DriveType":           enumRange(distortionTypeNames),
+	"Filter.Type":                enumRange(filterTypeNames),
+	"Filter.Env2ToFreq":          bipolar,
+	"VelocityEnvelope.Velocity":  bipolar,
+	"LFO.WaveForm":               enumRange(lfoWaveformNames),
+	"LFO.PhaseOffset":            {max: 119},
+	"LFO.DelaySync":              enumRange(syncRateNames),
+	"LFO.RateSync":               enumRange(syncRateNames),
+	"LFO.Flags":                  {max: 0x3f, discrete: true},
+	"Band.Level":                 bipolar,
+	"Distortion.Type":            enumRange(distortionTypeNames),
+	"Chorus.Type":                enumRange(chorusTypeNames),
+	"Chorus.RateSync":            enumRange(syncRateNames),
+	"Chorus.Feedback":            bipolar,
+	"Mod.Source1":                enumRange(modSourceNames),
+	"Mod.Source2":                enumRange(modSourceNames),
+	"Mod.Depth":                  bipolar,
+	"Mod.Destination":            enumRange(modDestinationNames),
+	"KnobTarget.Destination":     enumRange(macroDestinationNames),
+	"KnobTarget.Depth":           bipolar,
+}
+
+var defaultRange = paramRange{max: 127}
+
+var (
+	params     = walkParams(reflect.TypeOf(Patch{}), "", nil)
+	paramIndex = func() map[string]*Param {
+		idx := make(map[string]*Param)
+		for _, p := range params {
+			idx[p.Path] = p
+		}
+		return idx
+	}()
+)
+
+// walkParams lists the parameters of a struct type. Byte arrays (names,
+// reserved areas) and reserved fields are not parameters.
+func walkParams(t reflect.Type, prefix string, index []int) []*Param {
+	var res []*Param
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := append(append([]int(nil), index...), i)
+		path := prefix + f.Name
+		if f.Anonymous {
+			path = strings.TrimSuffix(prefix, ".")
+		}
+
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			res = append(res, walkParams(f.Type, path+".", idx)...)
+		case reflect.Array:
+			if f.Type.Elem().Kind() != reflect.Struct {
+				continue
+			}
+			for j := 0; j < f.Type.Len(); j++ {
+				res = append(res, walkParams(f.Type.Elem(), fmt.Sprintf("%s[%d].", path, j), append(idx, j))...)
+			}
+		case reflect.Uint8:
+			if strings.Contains(f.Name, "Reserved") {
+				continue
+			}
+			r, ok := paramRanges[t.Name()+"."+f.Name]
+			if !ok {
+				r = defaultRange
+			}
+			res = append(res, &Param{
+				Path:     path,
+				Min:      r.min,
+				Max:      r.max,
+				Center:   r.center,
+				Unit:     r.unit,
+				Discrete: r.discrete,
+				typ:      f.Type,
+				index:    idx,
+			})
+		}
+	}
+	return res
+}
+
+// Params returns the description of every patch parameter, in memory order.
+func Params() []*Param {
+	return append([]*Param(nil), params...)
+}
+
+// LookupParam returns the parameter at path, or nil.
+func LookupParam(path string) *Param {
+	return paramIndex[path]
+}
+
+func (p *Param) enum(v byte) enum {
+	e, ok := reflect.ValueOf(v).Convert(p.typ).Interface().(enum)
+	if !ok {
+		return nil
+	}
+	return e
+}
+
+// Valid reports whether v is a legal raw value for the parameter.
+func (p *Param) Valid(v byte) bool {
+	if v < p.Min || v > p.Max {
+		return false
+	}
+	if e := p.enum(v); e != nil {
+		return e.Valid()
+	}
+	return true
+}
+
+// Format returns a human-readable representation of the raw value v.
+func (p *Param) Format(v byte) string {
+	if e := p.enum(v); e != nil {
+		return e.String()
+	}
+	s := fmt.Sprintf("%d", v)
+	if p.Center != 0 {
+		s = fmt.Sprintf("%+d", int(v)-int(p.Center))
+	}
+	if p.Unit != "" {
+		s += " " + p.Unit
+	}
+	return s
+}
+
+func (p *Param) field(patch *Patch) reflect.Value {
+	v := reflect.ValueOf(patch).Elem()
+	for _, i := range p.index {
+		if v.Kind() == reflect.Struct {
+			v = v.Field(i)
+		} else {
+			v = v.Index(i)
+		}
+	}
+	return v
+}
+
+// RangeError reports a parameter value outside of its legal range.
+type RangeError struct {
+	// Path is the path of the parameter, or the names of its enclosing type
+	// and field (e.g. "LFO.WaveForm") for errors of the typed setters.
+	Path  string
+	Value byte
+}
+
+func (e *RangeError) Error() string {
+	if p := LookupParam(e.Path); p != nil {
+		return fmt.Sprintf("invalid value for %s: %d (want %d-%d)", e.Path, e.Value, p.Min, p.Max)
+	}
+	if r, ok := paramRanges[e.Path]; ok {
+		return fmt.Sprintf("invalid value for %s: %d (want %d-%d)", e.Path, e.Value, r.min, r.max)
+	}
+	return fmt.Sprintf("invalid value for %s: %d", e.Path, e.Value)
+}
+
+// Get returns the raw value of the parameter at path.
+func (p *Patch) Get(path string) (byte, error) {
+	param := LookupParam(path)
+	if param == nil {
+		return 0, fmt.Errorf("unknown parameter: %s", path)
+	}
+	return byte(param.field(p).Uint()), nil
+}
+
+// Set changes the raw value of the parameter at path, provided it is legal.
+func (p *Patch) Set(path string, v byte) error {
+	param := LookupParam(path)
+	if param == nil {
+		return fmt.Errorf("unknown parameter: %s", path)
+	}
+	if !param.Valid(v) {
+		return &RangeError{Path: path, Value: v}
+	}
+	param.field(p).SetUint(uint64(v))
+	return nil
+}
+
+func (v *Voice) SetPolyphonyMode(m PolyphonyMode) error {
+	if !m.Valid() {
+		return &RangeError{Path: "Voice.PolyphonyMode", Value: byte(m)}
+	}
+	v.PolyphonyMode = m
+	return nil
+}
+
+func (o *Oscillator) SetWave(w Waveform) error {
+	if !w.Valid() {
+		return &RangeError{Path: "Oscillator.Wave", Value: byte(w)}
+	}
+	o.Wave = w
+	return nil
+}
+
+func (f *Filter) SetRouting(r FilterRouting) error {
+	if !r.Valid() {
+		return &RangeError{Path: "Filter.Routing", Value: byte(r)}
+	}
+	f.Routing = r
+	return nil
+}
+
+func (f *Filter) SetDriveType(t DistortionType) error {
+	if !t.Valid() {
+		return &RangeError{Path: "Filter.DriveType", Value: byte(t)}
+	}
+	f.DriveType = t
+	return nil
+}
+
+func (f *Filter) SetType(t FilterType) error {
+	if !t.Valid() {
+		return &RangeError{Path: "Filter.Type", Value: byte(t)}
+	}
+	f.Type = t
+	return nil
+}
+
+func (d *Distortion) SetType(t DistortionType) error {
+	if !t.Valid() {
+		return &RangeError{Path: "Distortion.Type", Value: byte(t)}
+	}
+	d.Type = t
+	return nil
+}
+
+func (c *Chorus) SetType(t ChorusType) error {
+	if !t.Valid() {
+		return &RangeError{Path: "Chorus.Type", Value: byte(t)}
+	}
+	c.Type = t
+	return nil
+}
+
+func (c *Chorus) SetRateSync(r SyncRate) error {
+	if !r.Valid() {
+		return &RangeError{Path: "Chorus.RateSync", Value: byte(r)}
+	}
+	c.RateSync = r
+	return nil
+}
+
+func (l *LFO) SetWaveForm(w LFOWaveform) error {
+	if !w.Valid() {
+		return &RangeError{Path: "LFO.WaveForm", Value: byte(w)}
+	}
+	l.WaveForm = w
+	return nil
+}
+
+func (l *LFO) SetRateSync(r SyncRate) error {
+	if !r.Valid() {
+		return &RangeError{Path: "LFO.RateSync", Value: byte(r)}
+	}
+	l.RateSync = r
+	return nil
+}
+
+func (l *LFO) SetDelaySync(r SyncRate) error {
+	if !r.Valid() {
+		return &RangeError{Path: "LFO.DelaySync", Value: byte(r)}
+	}
+	l.DelaySync = r
+	return nil
+}
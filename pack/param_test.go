@@ -0,0 +1,109 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	// Every byte of a patch is either a parameter, or part of the name,
+	// metadata or reserved areas (16 + 14 + 3 + 5 bytes).
+	if n := len(Params()); n != 340-38 {
+		t.Errorf("Params() = %d parameters, want %d", n, 340-38)
+	}
+
+	data := []struct {
+		path     string
+		min, max byte
+		format   string
+		raw      byte
+	}{
+		{path: "Osc1.Wave", max: 29, format: "sawtooth", raw: byte(WaveSawtooth)},
+		{path: "Osc2.Semitones", max: 127, format: "-12 semitones", raw: 52},
+		{path: "Envelope1.Velocity", max: 127, format: "+0", raw: 64},
+		{path: "Envelope3.Delay", max: 127, format: "12", raw: 12},
+		{path: "Mixer.PreFXLevel", min: 52, max: 82, format: "+18 dB", raw: 82},
+		{path: "ModMatrix[4].Destination", max: 17, format: "filter frequency", raw: byte(ModDestFilterFrequency)},
+		{path: "Macros[7].D.Destination", max: 70, format: "mod matrix 20 depth", raw: 70},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+
+			p := LookupParam(tt.path)
+			if p == nil {
+				t.Fatalf("LookupParam(%q) = nil", tt.path)
+			}
+			if p.Min != tt.min || p.Max != tt.max {
+				t.Errorf("range = %d-%d, want %d-%d", p.Min, p.Max, tt.min, tt.max)
+			}
+			if got := p.Format(tt.raw); got != tt.format {
+				t.Errorf("Format(%d) = %q, want %q", tt.raw, got, tt.format)
+			}
+
+			patch := &Patch{}
+			if err := patch.Set(tt.path, tt.raw); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := patch.Get(tt.path); err != nil || v != tt.raw {
+				t.Errorf("Get() = %d, %v, want %d", v, err, tt.raw)
+			}
+			var rangeErr *RangeError
+			if err := patch.Set(tt.path, tt.max+1); !errors.As(err, &rangeErr) {
+				t.Errorf("Set(%d) = %v, want RangeError", tt.max+1, err)
+			}
+		})
+	}
+}
+
+func TestSetModSource(t *testing.T) {
+	p := &Patch{}
+	if err := p.Set("ModMatrix[0].Source1", 2); err == nil {
+		t.Errorf("Set() accepted a reserved mod source")
+	}
+	if err := p.Set("ModMatrix[0].Source1", byte(ModSourceEnv3)); err != nil {
+		t.Error(err)
+	}
+	if p.ModMatrix[0].Source1 != ModSourceEnv3 {
+		t.Errorf("Set() didn't update the patch")
+	}
+}
+
+func TestSetterRangeErrors(t *testing.T) {
+	t.Parallel()
+
+	p := &Patch{}
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{err: p.Voice.SetPolyphonyMode(3), want: "invalid value for Voice.PolyphonyMode: 3 (want 0-2)"},
+		{err: p.Osc1.SetWave(30), want: "invalid value for Oscillator.Wave: 30 (want 0-29)"},
+		{err: p.LFO1.SetWaveForm(38), want: "invalid value for LFO.WaveForm: 38 (want 0-37)"},
+		{err: p.Chorus.SetRateSync(36), want: "invalid value for Chorus.RateSync: 36 (want 0-35)"},
+	} {
+		if tc.err == nil {
+			t.Errorf("setter succeeded, want %q", tc.want)
+			continue
+		}
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("Error() = %q, want %q", got, tc.want)
+		}
+	}
+}
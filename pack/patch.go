@@ -17,101 +17,68 @@ package pack
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"strings"
 
 	"yrh.dev/circuit/model"
 )
 
-type Genre byte
-
-const (
-	GenreNone Genre = iota
-	GenreClassic
-	GenreBreaks
-	GenreHouse
-	GenreIndustrial
-	GenreJazz
-	GenreHipHop
-	GenrePopRock
-	GenreTechno
-	GenreDubStep
-)
-
-type Category byte
-
-const (
-	CategoryNone Category = iota
-	CategoryArp
-	CategoryBass
-	CategoryBell
-	CategoryClassic
-	CategoryDrum
-	CategoryKeyboard
-	CategoryLead
-	CategoryMotion
-	CategoryPad
-	CategoryPoly
-	CategorySFX
-	CategoryString
-	CategoryUser
-	CategoryVocal
-)
-
 type Voice struct {
-	PolyphonyMode  byte
-	PortamentoRate byte
-	PreGlide       byte
-	KeyboardOctave byte
+	PolyphonyMode  PolyphonyMode `json:"polyphonyMode" yaml:"polyphonyMode"`
+	PortamentoRate byte          `json:"portamentoRate" yaml:"portamentoRate"`
+	PreGlide       byte          `json:"preGlide" yaml:"preGlide"`
+	KeyboardOctave byte          `json:"keyboardOctave" yaml:"keyboardOctave"`
 }
 
 type Mixer struct {
-	Osc1Level       byte
-	Osc2Level       byte
-	RingModeLevel12 byte
-	NoiseLevel      byte
-	PreFXLevel      byte
-	PostFXLevel     byte
+	Osc1Level       byte `json:"osc1Level" yaml:"osc1Level"`
+	Osc2Level       byte `json:"osc2Level" yaml:"osc2Level"`
+	RingModeLevel12 byte `json:"ringModeLevel12" yaml:"ringModeLevel12"`
+	NoiseLevel      byte `json:"noiseLevel" yaml:"noiseLevel"`
+	PreFXLevel      byte `json:"preFXLevel" yaml:"preFXLevel"`
+	PostFXLevel     byte `json:"postFXLevel" yaml:"postFXLevel"`
 }
 
 type Filter struct {
-	Routing    byte
-	Drive      byte
-	DriveType  byte
-	Type       byte
-	Frequency  byte
-	Track      byte
-	Resonance  byte
-	QNormalize byte
-	Env2ToFreq byte
+	Routing    FilterRouting  `json:"routing" yaml:"routing"`
+	Drive      byte           `json:"drive" yaml:"drive"`
+	DriveType  DistortionType `json:"driveType" yaml:"driveType"`
+	Type       FilterType     `json:"type" yaml:"type"`
+	Frequency  byte           `json:"frequency" yaml:"frequency"`
+	Track      byte           `json:"track" yaml:"track"`
+	Resonance  byte           `json:"resonance" yaml:"resonance"`
+	QNormalize byte           `json:"qNormalize" yaml:"qNormalize"`
+	Env2ToFreq byte           `json:"env2ToFreq" yaml:"env2ToFreq"`
 }
 
 type Oscillator struct {
-	Wave             byte
-	WaveInterpolate  byte
-	PulseWidthIndex  byte
-	VirtualSyncDepth byte
-	Density          byte
-	DensityDetune    byte
-	Semitones        byte
-	Cents            byte
-	PitchBend        byte
+	Wave             Waveform `json:"wave" yaml:"wave"`
+	WaveInterpolate  byte     `json:"waveInterpolate" yaml:"waveInterpolate"`
+	PulseWidthIndex  byte     `json:"pulseWidthIndex" yaml:"pulseWidthIndex"`
+	VirtualSyncDepth byte     `json:"virtualSyncDepth" yaml:"virtualSyncDepth"`
+	Density          byte     `json:"density" yaml:"density"`
+	DensityDetune    byte     `json:"densityDetune" yaml:"densityDetune"`
+	Semitones        byte     `json:"semitones" yaml:"semitones"`
+	Cents            byte     `json:"cents" yaml:"cents"`
+	PitchBend        byte     `json:"pitchBend" yaml:"pitchBend"`
 }
 
 type ADSR struct {
-	Attack  byte
-	Decay   byte
-	Sustain byte
-	Release byte
+	Attack  byte `json:"attack" yaml:"attack"`
+	Decay   byte `json:"decay" yaml:"decay"`
+	Sustain byte `json:"sustain" yaml:"sustain"`
+	Release byte `json:"release" yaml:"release"`
 }
 
 type VelocityEnvelope struct {
-	Velocity byte
-	ADSR
+	Velocity byte `json:"velocity" yaml:"velocity"`
+	ADSR     `yaml:",inline"`
 }
 
 type DelayEnvelope struct {
-	Delay byte
-	ADSR
+	Delay byte `json:"delay" yaml:"delay"`
+	ADSR  `yaml:",inline"`
 }
 
 type FadeMode byte
@@ -123,136 +90,441 @@ const (
 	GateOut
 )
 
+var fadeModeNames = []string{
+	"fade in",
+	"fade out",
+	"gate in",
+	"gate out",
+}
+
+func (m FadeMode) String() string {
+	return enumString(fadeModeNames, byte(m), "FadeMode")
+}
+
 type LFOFlags byte
 
+const (
+	lfoOneShot           LFOFlags = 0x01
+	lfoKeySync           LFOFlags = 0x02
+	lfoCommonSync        LFOFlags = 0x04
+	lfoMultiDelayTrigger LFOFlags = 0x08
+	lfoFadeModeMask      LFOFlags = 0x30
+	lfoFadeModeShift              = 4
+)
+
+// LFOOptions is the decoded form of LFOFlags.
+type LFOOptions struct {
+	OneShot           bool
+	KeySync           bool
+	CommonSync        bool
+	MultiDelayTrigger bool
+	FadeMode          FadeMode
+}
+
+// NewLFOFlags encodes the options.
+func NewLFOFlags(o LFOOptions) LFOFlags {
+	var f LFOFlags
+	f.SetOneShot(o.OneShot)
+	f.SetKeySync(o.KeySync)
+	f.SetCommonSync(o.CommonSync)
+	f.SetMultiDelayTrigger(o.MultiDelayTrigger)
+	f.SetFadeMode(o.FadeMode)
+	return f
+}
+
+// Options decodes the flags.
+func (f LFOFlags) Options() LFOOptions {
+	return LFOOptions{
+		OneShot:           f.OneShot(),
+		KeySync:           f.KeySync(),
+		CommonSync:        f.CommonSync(),
+		MultiDelayTrigger: f.MultiDelayTrigger(),
+		FadeMode:          f.FadeMode(),
+	}
+}
+
+func (f *LFOFlags) set(mask LFOFlags, v bool) {
+	if v {
+		*f |= mask
+	} else {
+		*f &^= mask
+	}
+}
+
 func (f LFOFlags) OneShot() bool {
-	return f&0x01 != 0
+	return f&lfoOneShot != 0
+}
+
+func (f *LFOFlags) SetOneShot(v bool) {
+	f.set(lfoOneShot, v)
 }
 
 func (f LFOFlags) KeySync() bool {
-	return f&0x02 != 0
+	return f&lfoKeySync != 0
+}
+
+func (f *LFOFlags) SetKeySync(v bool) {
+	f.set(lfoKeySync, v)
 }
 
 func (f LFOFlags) CommonSync() bool {
-	return f&0x04 != 0
+	return f&lfoCommonSync != 0
+}
+
+func (f *LFOFlags) SetCommonSync(v bool) {
+	f.set(lfoCommonSync, v)
 }
 
 func (f LFOFlags) MultiDelayTrigger() bool {
-	return f&0x08 != 0
+	return f&lfoMultiDelayTrigger != 0
+}
+
+func (f *LFOFlags) SetMultiDelayTrigger(v bool) {
+	f.set(lfoMultiDelayTrigger, v)
 }
 
 func (f LFOFlags) FadeMode() FadeMode {
-	return FadeMode((f & 0x30) >> 4)
+	return FadeMode((f & lfoFadeModeMask) >> lfoFadeModeShift)
+}
+
+func (f *LFOFlags) SetFadeMode(m FadeMode) {
+	*f = *f&^lfoFadeModeMask | LFOFlags(m)<<lfoFadeModeShift&lfoFadeModeMask
+}
+
+// Valid reports whether only known bits are set.
+func (f LFOFlags) Valid() bool {
+	return f&^(lfoOneShot|lfoKeySync|lfoCommonSync|lfoMultiDelayTrigger|lfoFadeModeMask) == 0
+}
+
+func (f LFOFlags) String() string {
+	var parts []string
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{f.OneShot(), "one shot"},
+		{f.KeySync(), "key sync"},
+		{f.CommonSync(), "common sync"},
+		{f.MultiDelayTrigger(), "multi delay trigger"},
+	} {
+		if flag.set {
+			parts = append(parts, flag.name)
+		}
+	}
+	parts = append(parts, f.FadeMode().String())
+	if !f.Valid() {
+		parts = append(parts, fmt.Sprintf("0x%02x", byte(f&^0x3f)))
+	}
+	return strings.Join(parts, ", ")
 }
 
 type LFO struct {
-	WaveForm    byte
-	PhaseOffset byte
-	SlewRate    byte
-	Delay       byte
-	DelaySync   byte
-	Rate        byte
-	RateSync    byte
-	Flags       LFOFlags
+	WaveForm    LFOWaveform `json:"waveForm" yaml:"waveForm"`
+	PhaseOffset byte        `json:"phaseOffset" yaml:"phaseOffset"`
+	SlewRate    byte        `json:"slewRate" yaml:"slewRate"`
+	Delay       byte        `json:"delay" yaml:"delay"`
+	DelaySync   SyncRate    `json:"delaySync" yaml:"delaySync"`
+	Rate        byte        `json:"rate" yaml:"rate"`
+	RateSync    SyncRate    `json:"rateSync" yaml:"rateSync"`
+	Flags       LFOFlags    `json:"flags" yaml:"flags"`
 }
 
 type Band struct {
-	Frequency byte
-	Level     byte
+	Frequency byte `json:"frequency" yaml:"frequency"`
+	Level     byte `json:"level" yaml:"level"`
 }
 
 type Equalizer struct {
-	Bass, Mid, Trebble Band
+	Bass    Band `json:"bass" yaml:"bass"`
+	Mid     Band `json:"mid" yaml:"mid"`
+	Trebble Band `json:"trebble" yaml:"trebble"`
 }
 
 type Distortion struct {
-	Type         byte
-	Compensation byte
+	Type         DistortionType `json:"type" yaml:"type"`
+	Compensation byte           `json:"compensation" yaml:"compensation"`
 }
 
 type Chorus struct {
-	Type     byte
-	Rate     byte
-	RateSync byte
-	Feedback byte
-	ModDepth byte
-	Delay    byte
+	Type     ChorusType `json:"type" yaml:"type"`
+	Rate     byte       `json:"rate" yaml:"rate"`
+	RateSync SyncRate   `json:"rateSync" yaml:"rateSync"`
+	Feedback byte       `json:"feedback" yaml:"feedback"`
+	ModDepth byte       `json:"modDepth" yaml:"modDepth"`
+	Delay    byte       `json:"delay" yaml:"delay"`
 }
 
 type Mod struct {
-	Source1, Source2 byte
-	Depth            byte
-	Destination      byte
+	Source1     ModSource      `json:"source1" yaml:"source1"`
+	Source2     ModSource      `json:"source2" yaml:"source2"`
+	Depth       byte           `json:"depth" yaml:"depth"`
+	Destination ModDestination `json:"destination" yaml:"destination"`
 }
 
 type KnobTarget struct {
-	Destination byte
-	Start, End  byte
-	Depth       byte
+	Destination MacroDestination `json:"destination" yaml:"destination"`
+	Start       byte             `json:"start" yaml:"start"`
+	End         byte             `json:"end" yaml:"end"`
+	Depth       byte             `json:"depth" yaml:"depth"`
 }
 
 type Knob struct {
-	Position   byte
-	A, B, C, D KnobTarget
+	Position byte       `json:"position" yaml:"position"`
+	A        KnobTarget `json:"a" yaml:"a"`
+	B        KnobTarget `json:"b" yaml:"b"`
+	C        KnobTarget `json:"c" yaml:"c"`
+	D        KnobTarget `json:"d" yaml:"d"`
 }
 
 type Patch struct {
-	PatchName                [16]byte
-	Category                 Category
-	Genre                    Genre
-	Reserved                 [14]byte
-	Voice                    Voice
-	Osc1, Osc2               Oscillator
-	Mixer                    Mixer
-	Filter                   Filter
-	Envelope1, Envelope2     VelocityEnvelope
-	Envelope3                DelayEnvelope
-	LFO1, LFO2               LFO
-	DistortionLevel          byte
-	FXReserved1              byte
-	ChorusLevel              byte
-	FXReserved2, FXReserved3 byte
-	Equalizer                Equalizer
-	FXReserved               [5]byte
-	Distortion               Distortion
-	Chorus                   Chorus
-	ModMatrix                [20]Mod
-	Macros                   [8]Knob
+	PatchName       [16]byte         `json:"-" yaml:"-"`
+	Category        Category         `json:"category" yaml:"category"`
+	Genre           Genre            `json:"genre" yaml:"genre"`
+	Reserved        [14]byte         `json:"reserved" yaml:"reserved"`
+	Voice           Voice            `json:"voice" yaml:"voice"`
+	Osc1            Oscillator       `json:"osc1" yaml:"osc1"`
+	Osc2            Oscillator       `json:"osc2" yaml:"osc2"`
+	Mixer           Mixer            `json:"mixer" yaml:"mixer"`
+	Filter          Filter           `json:"filter" yaml:"filter"`
+	Envelope1       VelocityEnvelope `json:"envelope1" yaml:"envelope1"`
+	Envelope2       VelocityEnvelope `json:"envelope2" yaml:"envelope2"`
+	Envelope3       DelayEnvelope    `json:"envelope3" yaml:"envelope3"`
+	LFO1            LFO              `json:"lfo1" yaml:"lfo1"`
+	LFO2            LFO              `json:"lfo2" yaml:"lfo2"`
+	DistortionLevel byte             `json:"distortionLevel" yaml:"distortionLevel"`
+	FXReserved1     byte             `json:"fxReserved1" yaml:"fxReserved1"`
+	ChorusLevel     byte             `json:"chorusLevel" yaml:"chorusLevel"`
+	FXReserved2     byte             `json:"fxReserved2" yaml:"fxReserved2"`
+	FXReserved3     byte             `json:"fxReserved3" yaml:"fxReserved3"`
+	Equalizer       Equalizer        `json:"equalizer" yaml:"equalizer"`
+	FXReserved      [5]byte          `json:"fxReserved" yaml:"fxReserved"`
+	Distortion      Distortion       `json:"distortion" yaml:"distortion"`
+	Chorus          Chorus           `json:"chorus" yaml:"chorus"`
+	ModMatrix       [20]Mod          `json:"modMatrix" yaml:"modMatrix"`
+	Macros          [8]Knob          `json:"macros" yaml:"macros"`
 }
 
+// patchFlavors lists the flavors that share the patch format.
+var patchFlavors = []*model.Flavor{model.Circuit, model.CircuitTracks}
+
+var (
+	ErrFraming       = errors.New("missing sysex 0xf0/0xf7 framing")
+	ErrManufacturer  = errors.New("wrong manufacturer")
+	ErrUnknownFlavor = errors.New("unknown flavor")
+	ErrLength        = errors.New("bad message length")
+)
+
 func patchKind(sysex []byte) *model.Flavor {
-	for _, m := range []*model.Flavor{model.Circuit, model.CircuitTracks} {
-		if prefix := m.SysExPatchPrefix(); bytes.Equal(prefix, sysex[:len(prefix)]) {
+	for _, m := range patchFlavors {
+		if prefix := m.SysExPatchPrefix(); bytes.HasPrefix(sysex, prefix) {
 			return m
 		}
 	}
 	return nil
 }
 
-func NewPatch(sysex []byte) *Patch {
+func head(b []byte, n int) []byte {
+	if len(b) < n {
+		return b
+	}
+	return b[:n]
+}
+
+// ParsePatch decodes a complete patch sysex message, including its 0xf0/0xf7
+// framing. Errors wrap one of ErrFraming, ErrManufacturer, ErrUnknownFlavor or
+// ErrLength.
+func ParsePatch(msg []byte) (*Patch, *model.Flavor, error) {
+	if len(msg) < 2 || msg[0] != 0xf0 || msg[len(msg)-1] != 0xf7 {
+		return nil, nil, ErrFraming
+	}
+	sysex := msg[1 : len(msg)-1]
+
+	if !bytes.HasPrefix(sysex, model.VendorID) {
+		return nil, nil, fmt.Errorf("%w: % x", ErrManufacturer, head(sysex, len(model.VendorID)))
+	}
+
+	k := patchKind(sysex)
+	if k == nil {
+		return nil, nil, fmt.Errorf("%w: % x", ErrUnknownFlavor, head(sysex[len(model.VendorID):], 2))
+	}
+
+	if n := len(sysex); n != k.SysExSize {
+		return nil, nil, fmt.Errorf("%w: want %d, got %d for %s", ErrLength, k.SysExSize, n, k.Name)
+	}
+
 	var p Patch
-	if k := patchKind(sysex); k != nil {
-		if len(sysex) == k.SysExSize {
-			if err := binary.Read(bytes.NewReader(sysex[len(sysex)-340:]), binary.LittleEndian, &p); err != nil {
-				return nil
-			}
-		}
-		return &p
+	if err := binary.Read(bytes.NewReader(sysex[len(sysex)-340:]), binary.LittleEndian, &p); err != nil {
+		return nil, nil, err
 	}
-	return nil
+	return &p, k, nil
+}
+
+// NewPatch decodes a patch sysex message stripped of its framing. It returns
+// nil if the message is not a valid patch.
+//
+// Deprecated: use ParsePatch, which reports errors.
+func NewPatch(sysex []byte) *Patch {
+	msg := append(append([]byte{0xf0}, sysex...), 0xf7)
+	p, _, err := ParsePatch(msg)
+	if err != nil {
+		return nil
+	}
+	return p
 }
 
 func (p *Patch) Name() string {
 	if p == nil {
 		return ""
 	}
-	name := strings.TrimSpace(string(p.PatchName[:]))
+	name := strings.TrimSpace(strings.TrimRight(string(p.PatchName[:]), "\x00"))
 	if name == "" {
 		name = "Initial Patch"
 	}
 	return name
 }
 
+// SetName stores name, truncated to 16 characters and padded with spaces. It
+// fails if the name contains characters the device can't display, see
+// SanitizeName.
+func (p *Patch) SetName(name string) error {
+	var res [16]byte
+	for i := range res {
+		res[i] = ' '
+	}
+	for i, r := range []rune(name) {
+		if r < minNameChar || r > maxNameChar {
+			return fmt.Errorf("invalid character in patch name: %q", r)
+		}
+		if i < len(res) {
+			res[i] = byte(r)
+		}
+	}
+	p.PatchName = res
+	return nil
+}
+
+var transliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Æ': "AE",
+	'ç': "c", 'Ç': "C",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I",
+	'ñ': "n", 'Ñ': "N",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'œ': "oe",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Œ': "OE",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U",
+	'ý': "y", 'ÿ': "y", 'Ý': "Y",
+	'ß': "ss",
+	'‘': "'", '’': "'", '“': "\"", '”': "\"",
+	'–': "-", '—': "-", '…': "...",
+	'\t': " ",
+}
+
+// SanitizeName transliterates the characters of name the device can't
+// display, and replaces the remaining ones with '?'.
+func SanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch t, ok := transliterations[r]; {
+		case ok:
+			b.WriteString(t)
+		case r < minNameChar || r > maxNameChar:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (p *Patch) SetCategory(c Category) error {
+	if !c.Valid() {
+		return &RangeError{Path: "Category", Value: byte(c)}
+	}
+	p.Category = c
+	return nil
+}
+
+func (p *Patch) SetGenre(g Genre) error {
+	if !g.Valid() {
+		return &RangeError{Path: "Genre", Value: byte(g)}
+	}
+	p.Genre = g
+	return nil
+}
+
+// InitPatch returns the patch written to empty slots: the device's initial
+// patch, with the default values listed in the patch format of Novation's
+// Circuit Tracks Programmer's Reference Guide. Its mod matrix and macros are
+// inactive.
+func InitPatch() *Patch {
+	osc := Oscillator{
+		Wave:            WaveSawtooth,
+		WaveInterpolate: 127,
+		PulseWidthIndex: 64,
+		Semitones:       64,
+		Cents:           64,
+		PitchBend:       76,
+	}
+	lfo := LFO{Rate: 68}
+	band := Band{Frequency: 64, Level: 64}
+	p := &Patch{
+		Voice: Voice{
+			PolyphonyMode:  PolyphonyPoly,
+			PreGlide:       64,
+			KeyboardOctave: 64,
+		},
+		Osc1: osc,
+		Osc2: osc,
+		Mixer: Mixer{
+			Osc1Level:   127,
+			PreFXLevel:  64,
+			PostFXLevel: 64,
+		},
+		Filter: Filter{
+			Type:       FilterLowPass24,
+			Frequency:  127,
+			Track:      127,
+			QNormalize: 64,
+			Env2ToFreq: 64,
+		},
+		Envelope1: VelocityEnvelope{Velocity: 64, ADSR: ADSR{Attack: 2, Decay: 90, Sustain: 127, Release: 40}},
+		Envelope2: VelocityEnvelope{Velocity: 64, ADSR: ADSR{Attack: 2, Decay: 75, Sustain: 35, Release: 45}},
+		Envelope3: DelayEnvelope{ADSR: ADSR{Attack: 10, Decay: 70, Sustain: 64, Release: 40}},
+		LFO1:      lfo,
+		LFO2:      lfo,
+		Equalizer: Equalizer{Bass: band, Mid: band, Trebble: band},
+		Distortion: Distortion{
+			Compensation: 100,
+		},
+		Chorus: Chorus{
+			Type:     ChorusChorus,
+			Rate:     20,
+			Feedback: 74,
+			ModDepth: 64,
+			Delay:    64,
+		},
+	}
+	_ = p.SetName("Initial Patch")
+	for i := range p.ModMatrix {
+		p.ModMatrix[i].Depth = ModDepthCenter
+	}
+	for i := range p.Macros {
+		for _, t := range p.Macros[i].Targets() {
+			*t = KnobTarget{End: 127, Depth: 64}
+		}
+	}
+	return p
+}
+
+// isInit reports whether p is the patch of empty slots.
+func (p *Patch) isInit() bool {
+	return *p == *InitPatch()
+}
+
 type PatchConfig struct {
 	Flavor *model.Flavor
 	Index  byte
@@ -275,11 +547,13 @@ func (p *Patch) Format(cfg *PatchConfig) []byte {
 		0x00, // Reserved byte, always set to 0
 	)
 
+	// Empty slots are filled with the init patch.
+	if p == nil {
+		p = InitPatch()
+	}
 	data := new(bytes.Buffer)
-	if p != nil {
-		if err := binary.Write(data, binary.LittleEndian, p); err != nil {
-			return nil
-		}
+	if err := binary.Write(data, binary.LittleEndian, p); err != nil {
+		return nil
 	}
 
 	res := append(
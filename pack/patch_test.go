@@ -15,8 +15,13 @@
 package pack
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 	"unsafe"
+
+	"github.com/google/go-cmp/cmp"
+	"yrh.dev/circuit/model"
 )
 
 func TestPatchSize(t *testing.T) {
@@ -27,3 +32,174 @@ func TestPatchSize(t *testing.T) {
 		t.Fatalf("unexpected patch size: %d", patchSize)
 	}
 }
+
+func TestParsePatch(t *testing.T) {
+	frame := func(b []byte) []byte {
+		return append(append([]byte{0xf0}, b...), 0xf7)
+	}
+	circuit := frame(testPatch("Bass            ").Format(&PatchConfig{Flavor: model.Circuit}))
+	tracks := frame(testPatch("Bass            ").Format(&PatchConfig{Flavor: model.CircuitTracks}))
+
+	data := []struct {
+		name   string
+		msg    []byte
+		flavor *model.Flavor
+		err    error
+	}{
+		{name: "circuit", msg: circuit, flavor: model.Circuit},
+		{name: "circuit tracks", msg: tracks, flavor: model.CircuitTracks},
+		{name: "missing framing", msg: circuit[1:], err: ErrFraming},
+		{name: "wrong manufacturer", msg: frame([]byte{0x00, 0x20, 0x30, 0x01, 0x60}), err: ErrManufacturer},
+		{name: "unknown flavor", msg: frame([]byte{0x00, 0x20, 0x29, 0x01, 0x70}), err: ErrUnknownFlavor},
+		{name: "bad length", msg: frame(circuit[1 : len(circuit)-2]), err: ErrLength},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, f, err := ParsePatch(tt.msg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParsePatch() error = %v, want %v", err, tt.err)
+			}
+			if f != tt.flavor {
+				t.Errorf("ParsePatch() flavor = %v, want %v", f, tt.flavor)
+			}
+			if tt.err == nil && p.Name() != "Bass" {
+				t.Errorf("ParsePatch() name = %q, want %q", p.Name(), "Bass")
+			}
+		})
+	}
+}
+
+func TestReadBadPatch(t *testing.T) {
+	good := append([]byte{0xf0}, testPatch("Bass            ").Format(&PatchConfig{Flavor: model.Circuit})...)
+	good = append(good, 0xf7)
+	bad := append(append([]byte(nil), good[:len(good)-2]...), 0xf7)
+
+	p := &Pack{}
+	err := p.Read(bytes.NewReader(append(good, bad...)))
+
+	var msgErr *MessageError
+	if !errors.As(err, &msgErr) {
+		t.Fatalf("Read() = %v, want MessageError", err)
+	}
+	if msgErr.Offset != len(good) {
+		t.Errorf("Read() offset = %d, want %d", msgErr.Offset, len(good))
+	}
+	if !errors.Is(err, ErrLength) {
+		t.Errorf("Read() = %v, want ErrLength", err)
+	}
+}
+
+func TestSetName(t *testing.T) {
+	data := []struct {
+		name       string
+		want       string
+		shouldFail bool
+	}{
+		{name: "Bass", want: "Bass            "},
+		{name: "A very long patch name", want: "A very long patc"},
+		{name: "Crème brûlée", shouldFail: true},
+		{name: SanitizeName("Crème brûlée…"), want: "Creme brulee... "},
+		{name: SanitizeName("Bass\x00日本"), want: "Bass???         "},
+	}
+
+	for _, tt := range data {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := &Patch{}
+			err := p.SetName(tt.name)
+			if (err != nil) != tt.shouldFail {
+				t.Fatal(err)
+			}
+			if got := string(p.PatchName[:]); !tt.shouldFail && got != tt.want {
+				t.Errorf("SetName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNameTrimsNUL(t *testing.T) {
+	p := &Patch{}
+	copy(p.PatchName[:], "Bass")
+	if got := p.Name(); got != "Bass" {
+		t.Errorf("Name() = %q, want %q", got, "Bass")
+	}
+}
+
+func TestLFOFlags(t *testing.T) {
+	t.Parallel()
+
+	opts := LFOOptions{KeySync: true, MultiDelayTrigger: true, FadeMode: GateOut}
+	f := NewLFOFlags(opts)
+	if got, want := f, LFOFlags(0x3a); got != want {
+		t.Errorf("NewLFOFlags() = %#x, want %#x", got, want)
+	}
+	if diff := cmp.Diff(opts, f.Options()); diff != "" {
+		t.Errorf("Options() mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := f.String(), "key sync, multi delay trigger, gate out"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	f.SetKeySync(false)
+	f.SetOneShot(true)
+	f.SetFadeMode(FadeOut)
+	if got, want := f, LFOFlags(0x19); got != want {
+		t.Errorf("flags = %#x, want %#x", got, want)
+	}
+}
+
+func TestInitPatch(t *testing.T) {
+	t.Parallel()
+
+	p := InitPatch()
+	for _, f := range []*model.Flavor{model.Circuit, model.CircuitTracks} {
+		if err := p.Validate(f); err != nil {
+			t.Errorf("%s: Validate() = %v", f.Name, err)
+		}
+	}
+	if got, want := string(p.PatchName[:]), "Initial Patch   "; got != want {
+		t.Errorf("PatchName = %q, want %q", got, want)
+	}
+	// The initial patch plays an open sawtooth.
+	if p.Osc1.Wave != WaveSawtooth || p.Mixer.Osc1Level != 127 || p.Filter.Frequency != 127 || p.Envelope1.Sustain != 127 {
+		t.Errorf("InitPatch() is not audible: %+v", p)
+	}
+	if m := p.MacroMappings(); len(m) != 0 {
+		t.Errorf("MacroMappings() = %v, want none", m)
+	}
+	if _, err := p.AddMod(ModSourceVelocity, ModSourceDirect, ModDestFilterFrequency, 10); err != nil {
+		t.Errorf("AddMod() = %v", err)
+	}
+}
+
+func TestEmptySlotsRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	if err := (&Pack{}).Write(buf, model.CircuitTracks); err != nil {
+		t.Fatal(err)
+	}
+	out := &Pack{}
+	if err := out.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range out.Patches {
+		if p != nil {
+			t.Fatalf("slot %d: got patch %q, want nil", i, p.Name())
+		}
+	}
+	if refs := out.FindPatches(nil); len(refs) != 0 {
+		t.Errorf("FindPatches() = %d patches, want none", len(refs))
+	}
+	s := &DuplicateScanner{}
+	s.AddPack("empty", out)
+	if g := s.Groups(); len(g) != 0 {
+		t.Errorf("Groups() = %d groups, want none", len(g))
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"yrh.dev/circuit/model"
+)
+
+type TrackKind byte
+
+const (
+	TrackSynth TrackKind = iota
+	TrackMIDI
+	TrackDrum
+)
+
+func (k TrackKind) String() string {
+	switch k {
+	case TrackSynth:
+		return "synth"
+	case TrackMIDI:
+		return "midi"
+	case TrackDrum:
+		return "drum"
+	}
+	return fmt.Sprintf("TrackKind(%d)", byte(k))
+}
+
+// TrackKinds returns the kind of every track of a project for the flavor.
+func TrackKinds(f *model.Flavor) []TrackKind {
+	if l := projectLayouts[f]; l != nil {
+		return append([]TrackKind(nil), l.kinds...)
+	}
+	return nil
+}
+
+const (
+	// PatternsPerTrack is the number of patterns available on each track.
+	PatternsPerTrack = 8
+	// NotesPerStep is the maximum number of notes a synth step can hold.
+	NotesPerStep = 6
+	// MicroSteps is the number of micro-steps within a step.
+	MicroSteps = 6
+	// AutomationLanes is the number of macro knobs that can be automated.
+	AutomationLanes = 8
+)
+
+type Direction byte
+
+const (
+	DirectionForward Direction = iota
+	DirectionReverse
+	DirectionPingPong
+	DirectionRandom
+)
+
+// Note is a single note of a step. Drum tracks only use the first note of a
+// step, and ignore its number.
+type Note struct {
+	Number   byte
+	Velocity byte // 0 means no note
+	Gate     byte // in micro-steps
+	Micro    byte // offset from the start of the step, in micro-steps
+}
+
+// Step holds the notes triggered on a step, and the per-step automation.
+type Step struct {
+	Probability byte // in 1/8th, 0 means always
+	Notes       [NotesPerStep]Note
+	Automation  [AutomationLanes]byte
+}
+
+const automationSet = 0x80
+
+func (s *Step) Active() bool {
+	for _, n := range s.Notes {
+		if n.Velocity != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Chance returns the probability for the step to be played, between 0 and 1.
+func (s *Step) Chance() float64 {
+	if s.Probability == 0 {
+		return 1
+	}
+	return float64(s.Probability) / 8
+}
+
+// AddNote stores n in the first free note of the step.
+func (s *Step) AddNote(n Note) error {
+	if n.Velocity == 0 || n.Velocity > 127 {
+		return fmt.Errorf("invalid velocity: %d", n.Velocity)
+	}
+	if n.Micro >= MicroSteps {
+		return fmt.Errorf("invalid micro-step offset: %d", n.Micro)
+	}
+	for i := range s.Notes {
+		if s.Notes[i].Velocity == 0 {
+			s.Notes[i] = n
+			return nil
+		}
+	}
+	return fmt.Errorf("too many notes in step: %d", NotesPerStep)
+}
+
+// ActiveNotes returns the notes triggered by the step.
+func (s *Step) ActiveNotes() []Note {
+	var notes []Note
+	for _, n := range s.Notes {
+		if n.Velocity != 0 {
+			notes = append(notes, n)
+		}
+	}
+	return notes
+}
+
+func checkAutomationLane(knob int) error {
+	if knob < 0 || knob >= AutomationLanes {
+		return fmt.Errorf("invalid automation knob: %d", knob)
+	}
+	return nil
+}
+
+// AutomationValue returns the value recorded for the macro knob, if any.
+func (s *Step) AutomationValue(knob int) (byte, bool, error) {
+	if err := checkAutomationLane(knob); err != nil {
+		return 0, false, err
+	}
+	v := s.Automation[knob]
+	return v &^ automationSet, v&automationSet != 0, nil
+}
+
+func (s *Step) SetAutomation(knob int, value byte) error {
+	if err := checkAutomationLane(knob); err != nil {
+		return err
+	}
+	if value > 127 {
+		return fmt.Errorf("invalid automation value: %d", value)
+	}
+	s.Automation[knob] = automationSet | value
+	return nil
+}
+
+func (s *Step) ClearAutomation(knob int) error {
+	if err := checkAutomationLane(knob); err != nil {
+		return err
+	}
+	s.Automation[knob] = 0
+	return nil
+}
+
+// Pattern is a sequence of steps, played from Start to End.
+type Pattern struct {
+	Start, End byte
+	SyncRate   byte
+	Direction  Direction
+	Steps      []Step
+}
+
+// patternHeader and Step are the guessed encoding of patterns in projects.
+// Like the offsets of projectLayouts, they are unverified.
+type patternHeader struct {
+	Start, End byte
+	SyncRate   byte
+	Direction  Direction
+}
+
+var (
+	patternHeaderSize = binary.Size(patternHeader{})
+	stepSize          = binary.Size(Step{})
+)
+
+// NewPattern returns an empty pattern spanning all the steps available for
+// the flavor.
+func NewPattern(f *model.Flavor) (*Pattern, error) {
+	l, err := layoutFor(f)
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{
+		End:   byte(l.numSteps - 1),
+		Steps: make([]Step, l.numSteps),
+	}, nil
+}
+
+func (l *projectLayout) pattern(track, index int) (int, error) {
+	if track < 0 || track >= len(l.kinds) {
+		return 0, fmt.Errorf("invalid track: %d", track)
+	}
+	if index < 0 || index >= PatternsPerTrack {
+		return 0, fmt.Errorf("invalid pattern: %d", index)
+	}
+	size := patternHeaderSize + l.numSteps*stepSize
+	return l.patterns + (track*PatternsPerTrack+index)*size, nil
+}
+
+func (l *projectLayout) checkBounds(start, end byte) error {
+	if start > end || int(end) >= l.numSteps {
+		return fmt.Errorf("invalid pattern bounds: %d-%d", start, end)
+	}
+	return nil
+}
+
+// Pattern decodes the pattern at index for the track. It returns
+// ErrUnverifiedLayout until the layout of the flavor is verified.
+func (p *Project) Pattern(f *model.Flavor, track, index int) (*Pattern, error) {
+	l, err := verifiedLayoutFor(f)
+	if err != nil {
+		return nil, err
+	}
+	return p.readPattern(l, track, index)
+}
+
+func (p *Project) readPattern(l *projectLayout, track, index int) (*Pattern, error) {
+	offset, err := l.pattern(track, index)
+	if err != nil {
+		return nil, err
+	}
+	data, err := p.view(l)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(data[offset:])
+	var h patternHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if err := l.checkBounds(h.Start, h.End); err != nil {
+		return nil, err
+	}
+	pat := &Pattern{
+		Start:     h.Start,
+		End:       h.End,
+		SyncRate:  h.SyncRate,
+		Direction: h.Direction,
+		Steps:     make([]Step, l.numSteps),
+	}
+	if err := binary.Read(r, binary.LittleEndian, pat.Steps); err != nil {
+		return nil, err
+	}
+	return pat, nil
+}
+
+// SetPattern encodes pat at index for the track. It returns
+// ErrUnverifiedLayout until the layout of the flavor is verified.
+func (p *Project) SetPattern(f *model.Flavor, track, index int, pat *Pattern) error {
+	l, err := verifiedLayoutFor(f)
+	if err != nil {
+		return err
+	}
+	return p.writePattern(l, track, index, pat)
+}
+
+func (p *Project) writePattern(l *projectLayout, track, index int, pat *Pattern) error {
+	offset, err := l.pattern(track, index)
+	if err != nil {
+		return err
+	}
+	if n := len(pat.Steps); n != l.numSteps {
+		return fmt.Errorf("wrong number of steps: want %d, got %d", l.numSteps, n)
+	}
+	if err := l.checkBounds(pat.Start, pat.End); err != nil {
+		return err
+	}
+	data, err := p.data(l)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, &patternHeader{
+		Start:     pat.Start,
+		End:       pat.End,
+		SyncRate:  pat.SyncRate,
+		Direction: pat.Direction,
+	})
+	_ = binary.Write(buf, binary.LittleEndian, pat.Steps)
+	copy(data[offset:], buf.Bytes())
+
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"yrh.dev/circuit/model"
+)
+
+func TestPatternRoundTrip(t *testing.T) {
+	for _, f := range []*model.Flavor{model.Circuit, model.CircuitTracks} {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			t.Parallel()
+
+			l := projectLayouts[f]
+			p := &Project{}
+			last := len(TrackKinds(f)) - 1
+
+			pat, err := NewPattern(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := pat.Steps[0].AddNote(Note{Number: 60, Velocity: 100, Gate: 6}); err != nil {
+				t.Fatal(err)
+			}
+			if err := pat.Steps[0].AddNote(Note{Number: 64, Velocity: 90, Gate: 3, Micro: 2}); err != nil {
+				t.Fatal(err)
+			}
+			if err := pat.Steps[len(pat.Steps)-1].SetAutomation(3, 127); err != nil {
+				t.Fatal(err)
+			}
+			pat.Steps[1].Probability = 4
+
+			for _, track := range []int{0, last} {
+				if err := p.writePattern(l, track, PatternsPerTrack-1, pat); err != nil {
+					t.Fatal(err)
+				}
+				got, err := p.readPattern(l, track, PatternsPerTrack-1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(pat, got); diff != "" {
+					t.Errorf("Pattern() mismatch (-want +got):\n%s", diff)
+				}
+			}
+
+			if _, err := p.readPattern(l, last+1, 0); err == nil {
+				t.Errorf("Pattern() accepted an invalid track")
+			}
+			if n := len(p.Data); n != l.size {
+				t.Errorf("SetPattern() changed project size: %d", n)
+			}
+		})
+	}
+}
+
+func TestStepAddNote(t *testing.T) {
+	var s Step
+	for i := 0; i < NotesPerStep; i++ {
+		if err := s.AddNote(Note{Number: byte(60 + i), Velocity: 100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddNote(Note{Number: 72, Velocity: 100}); err == nil {
+		t.Errorf("AddNote() accepted more than %d notes", NotesPerStep)
+	}
+	if n := len(s.ActiveNotes()); n != NotesPerStep {
+		t.Errorf("ActiveNotes() = %d notes, want %d", n, NotesPerStep)
+	}
+}
+
+func TestStepAutomation(t *testing.T) {
+	t.Parallel()
+
+	var s Step
+	if err := s.SetAutomation(2, 42); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := s.AutomationValue(2); err != nil || !ok || v != 42 {
+		t.Errorf("AutomationValue(2) = %d, %t, %v, want 42, true, nil", v, ok, err)
+	}
+	if err := s.ClearAutomation(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.AutomationValue(2); ok {
+		t.Errorf("AutomationValue(2) is set after ClearAutomation()")
+	}
+
+	for _, knob := range []int{-1, AutomationLanes} {
+		if err := s.SetAutomation(knob, 1); err == nil {
+			t.Errorf("SetAutomation(%d) succeeded, want error", knob)
+		}
+		if _, _, err := s.AutomationValue(knob); err == nil {
+			t.Errorf("AutomationValue(%d) succeeded, want error", knob)
+		}
+		if err := s.ClearAutomation(knob); err == nil {
+			t.Errorf("ClearAutomation(%d) succeeded, want error", knob)
+		}
+	}
+}
+
+func TestPatternBadBounds(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range []*model.Flavor{model.Circuit, model.CircuitTracks} {
+		l := projectLayouts[f]
+		offset, err := l.pattern(1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, bounds := range [][2]byte{{0, byte(l.numSteps)}, {5, 4}} {
+			p := &Project{Data: l.empty()}
+			p.Data[offset], p.Data[offset+1] = bounds[0], bounds[1]
+			if _, err := p.readPattern(l, 1, 2); err == nil {
+				t.Errorf("%s: Pattern() with bounds %d-%d succeeded, want error", f.Name, bounds[0], bounds[1])
+			}
+		}
+	}
+}
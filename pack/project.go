@@ -14,7 +14,11 @@
 
 package pack
 
-import "yrh.dev/circuit/model"
+import (
+	"fmt"
+
+	"yrh.dev/circuit/model"
+)
 
 var (
 	emptyProject = []byte{
@@ -28,15 +32,41 @@ type ProjectConfig struct {
 	Flavor *model.Flavor
 }
 
-type Project struct{}
+type Project struct {
+	Name string
+	Data []byte
+}
+
+func NewProject(name string, data []byte) *Project {
+	return &Project{
+		Name: name,
+		Data: data,
+	}
+}
+
+// Format returns the raw project data for the flavor. A project with no
+// data is formatted as an empty one, and data of the wrong size is an error.
+func (p *Project) Format(cfg *ProjectConfig) ([]byte, error) {
+	l := projectLayouts[cfg.Flavor]
+	if l == nil {
+		return nil, fmt.Errorf("unsupported flavor: %s", cfg.Flavor.Name)
+	}
 
-func (p *Project) Format(cfg *ProjectConfig) []byte {
-	var data []byte
+	if err := p.checkSize(l); err != nil {
+		return nil, err
+	}
 
-	if cfg.Flavor == model.CircuitTracks {
-		data = make([]byte, 160780)
-		copy(data, emptyProject)
+	data := l.empty()
+	if p != nil && p.Data != nil {
+		copy(data, p.Data)
 	}
 
-	return data
+	return data, nil
+}
+
+func (p *Project) checkSize(l *projectLayout) error {
+	if p != nil && p.Data != nil && len(p.Data) != l.size {
+		return fmt.Errorf("project %q: %w: %d bytes, want %d", p.Name, ErrLength, len(p.Data), l.size)
+	}
+	return nil
 }
@@ -0,0 +1,174 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"yrh.dev/circuit/model"
+)
+
+// Randomizer generates patches with random, legal values.
+type Randomizer struct {
+	// Rand is the source of randomness. Use a seeded source for reproducible
+	// results. When nil, a source seeded with the current time is created.
+	Rand *rand.Rand
+	// Seed is the patch variations are computed from. When nil, variations
+	// are computed from InitPatch.
+	Seed *Patch
+	// Variation is the maximum change from the seed, as a fraction of the
+	// range of each parameter: values are drawn uniformly from that window,
+	// cut to the legal range. It is also the chance for a discrete parameter
+	// to change. Values outside of [0, 1] are clamped.
+	Variation float64
+	// Locked lists the sections (e.g. "Filter" or "Macros") or parameters
+	// that are kept from the seed.
+	Locked []string
+	// Category and Genre are stored in the patches, and the category narrows
+	// some parameters to fit the kind of sound.
+	Category Category
+	Genre    Genre
+}
+
+// NewRandomizer returns a randomizer that draws every parameter from its full
+// range, using a source seeded with seed.
+func NewRandomizer(seed int64) *Randomizer {
+	return &Randomizer{
+		Rand:      rand.New(rand.NewSource(seed)),
+		Variation: 1,
+	}
+}
+
+type paramBounds struct {
+	min, max byte
+}
+
+// categoryBounds narrows parameters for some categories.
+var categoryBounds = map[Category]map[string]paramBounds{
+	CategoryBass: {
+		"Voice.PolyphonyMode":  {byte(PolyphonyMono), byte(PolyphonyMonoAutoGlide)},
+		"Voice.KeyboardOctave": {58, 64},
+		"Envelope1.Attack":     {0, 20},
+	},
+	CategoryLead: {
+		"Voice.PolyphonyMode": {byte(PolyphonyMono), byte(PolyphonyMonoAutoGlide)},
+		"Envelope1.Attack":    {0, 40},
+	},
+	CategoryPad: {
+		"Voice.PolyphonyMode": {byte(PolyphonyPoly), byte(PolyphonyPoly)},
+		"Envelope1.Attack":    {40, 127},
+		"Envelope1.Sustain":   {64, 127},
+		"Envelope1.Release":   {60, 127},
+	},
+	CategoryDrum: {
+		"Envelope1.Attack":  {0, 10},
+		"Envelope1.Sustain": {0, 20},
+	},
+	CategoryString: {
+		"Voice.PolyphonyMode": {byte(PolyphonyPoly), byte(PolyphonyPoly)},
+		"Envelope1.Attack":    {20, 100},
+	},
+}
+
+func (r *Randomizer) locked(path string) bool {
+	for _, l := range r.Locked {
+		if path == l || strings.HasPrefix(path, l+".") || strings.HasPrefix(path, l+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Randomizer) value(param *Param, seed byte) byte {
+	min, max := param.Min, param.Max
+	if b, ok := categoryBounds[r.Category][param.Path]; ok {
+		min, max = b.min, b.max
+	}
+
+	if param.Discrete {
+		if r.Rand.Float64() >= r.variation() && seed >= min && seed <= max {
+			return seed
+		}
+		for {
+			if v := min + byte(r.Rand.Intn(int(max-min)+1)); param.Valid(v) {
+				return v
+			}
+		}
+	}
+
+	// Drawing in the window rather than clamping the draw keeps values from
+	// piling up at the bounds.
+	spread := int(math.Round(r.variation() * float64(param.Max-param.Min)))
+	center := int(seed)
+	if center < int(min) {
+		center = int(min)
+	} else if center > int(max) {
+		center = int(max)
+	}
+	lo, hi := center-spread, center+spread
+	if lo < int(min) {
+		lo = int(min)
+	}
+	if hi > int(max) {
+		hi = int(max)
+	}
+	return byte(lo + r.Rand.Intn(hi-lo+1))
+}
+
+// variation returns Variation, clamped to [0, 1].
+func (r *Randomizer) variation() float64 {
+	if math.IsNaN(r.Variation) {
+		return 0
+	}
+	return math.Max(0, math.Min(1, r.Variation))
+}
+
+// Patch returns a new random patch.
+func (r *Randomizer) Patch() *Patch {
+	if r.Rand == nil {
+		r.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	seed := r.Seed
+	if seed == nil {
+		seed = InitPatch()
+	}
+
+	p := *seed
+	p.Category = r.Category
+	p.Genre = r.Genre
+	for _, param := range params {
+		if param.Path == "Category" || param.Path == "Genre" || r.locked(param.Path) {
+			continue
+		}
+		param.field(&p).SetUint(uint64(r.value(param, byte(param.field(seed).Uint()))))
+	}
+	return &p
+}
+
+// FillPatches fills the empty patch slots of the pack, up to the capacity of
+// the flavor, with random patches.
+func (p *Pack) FillPatches(f *model.Flavor, r *Randomizer) {
+	for len(p.Patches) < f.NumberPatches {
+		p.Patches = append(p.Patches, nil)
+	}
+	for i, patch := range p.Patches {
+		if patch == nil {
+			p.Patches[i] = r.Patch()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"yrh.dev/circuit/model"
+)
+
+func TestRandomizer(t *testing.T) {
+	seed := validPatch(t)
+	seed.Filter.Frequency = 100
+
+	newRandomizer := func() *Randomizer {
+		r := NewRandomizer(42)
+		r.Seed = seed
+		r.Variation = 0.3
+		r.Locked = []string{"Filter", "Macros"}
+		r.Category = CategoryPad
+		return r
+	}
+
+	r := newRandomizer()
+	patches := []*Patch{r.Patch(), r.Patch(), r.Patch()}
+
+	if diff := cmp.Diff(patches[0], newRandomizer().Patch()); diff != "" {
+		t.Errorf("Patch() is not reproducible (-want +got):\n%s", diff)
+	}
+	if cmp.Equal(patches[0], patches[1]) {
+		t.Errorf("Patch() returned the same patch twice")
+	}
+
+	for _, p := range patches {
+		if err := p.Validate(model.CircuitTracks); err != nil {
+			t.Error(err)
+		}
+		if p.Filter != seed.Filter || p.Macros != seed.Macros {
+			t.Errorf("Patch() changed a locked section")
+		}
+		if p.Category != CategoryPad || p.Voice.PolyphonyMode != PolyphonyPoly {
+			t.Errorf("Patch() ignored the category")
+		}
+	}
+}
+
+func TestRandomizerSpread(t *testing.T) {
+	t.Parallel()
+	r := NewRandomizer(42)
+	var bounds int
+	for i := 0; i < 1000; i++ {
+		if f := r.Patch().Filter.Frequency; f == 0 || f == 127 {
+			bounds++
+		}
+	}
+	// A uniform draw hits either bound about 16 times in 1000.
+	if bounds > 50 {
+		t.Errorf("Patch() drew %d/1000 filter frequencies at the bounds", bounds)
+	}
+}
+
+func TestFillPatches(t *testing.T) {
+	p := &Pack{Patches: []*Patch{testPatch("Keep"), nil}}
+	p.FillPatches(model.CircuitTracks, NewRandomizer(1))
+
+	if n := len(p.Patches); n != model.CircuitTracks.NumberPatches {
+		t.Fatalf("FillPatches() = %d patches, want %d", n, model.CircuitTracks.NumberPatches)
+	}
+	if p.Patches[0].Name() != "Keep" {
+		t.Errorf("FillPatches() replaced an existing patch")
+	}
+	for i, patch := range p.Patches[1:] {
+		if err := patch.Validate(model.CircuitTracks); err != nil {
+			t.Errorf("slot %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestRandomizerDefaults(t *testing.T) {
+	t.Parallel()
+
+	r := &Randomizer{}
+	if err := r.Patch().Validate(model.CircuitTracks); err != nil {
+		t.Errorf("zero Randomizer: %v", err)
+	}
+	for _, v := range []float64{-1, 2, math.NaN()} {
+		r := NewRandomizer(42)
+		r.Variation = v
+		if err := r.Patch().Validate(model.CircuitTracks); err != nil {
+			t.Errorf("Variation %v: %v", v, err)
+		}
+	}
+}
@@ -14,9 +14,133 @@
 
 package pack
 
-import "io"
+import (
+	"io"
+	"io/ioutil"
+	"time"
+)
 
+// PCM is decoded audio. Samples of all channels are interleaved and scaled
+// to [-1, 1].
+type PCM struct {
+	SampleRate int
+	Channels   int
+	// BitDepth is the number of bits per sample once encoded.
+	BitDepth int
+	// Float is true for IEEE float encoding.
+	Float bool
+	Data  []float64
+}
+
+// Frames returns the number of samples per channel.
+func (p *PCM) Frames() int {
+	if p.Channels == 0 {
+		return 0
+	}
+	return len(p.Data) / p.Channels
+}
+
+// Duration returns the playing time of the audio.
+func (p *PCM) Duration() time.Duration {
+	if p.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(p.Frames()) * time.Second / time.Duration(p.SampleRate)
+}
+
+// Clone returns a deep copy of p.
+func (p *PCM) Clone() *PCM {
+	c := *p
+	c.Data = append([]float64(nil), p.Data...)
+	return &c
+}
+
+// Processor transforms the audio of a sample. Implementations must not
+// modify their input. The sample package provides editing operations.
+type Processor interface {
+	Process(p *PCM) (*PCM, error)
+}
+
+// Sample is an audio sample of a pack. A sample with no audio leaves its
+// slot empty.
+//
+// A sample keeps the WAV file it was created from, and decodes it on first
+// use. Both forms can be accessed any number of times.
 type Sample struct {
 	Name string
-	Data io.Reader
+	// Processor, when set, is applied each time the pack is written. The
+	// audio held by the sample is left unchanged.
+	Processor Processor
+
+	wav []byte
+	pcm *PCM
+	err error
+}
+
+// NewSample returns a sample holding the WAV file data.
+func NewSample(name string, data []byte) *Sample {
+	return &Sample{Name: name, wav: data}
+}
+
+// ReadSample returns a sample holding the WAV file read from r.
+func ReadSample(name string, r io.Reader) (*Sample, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewSample(name, data), nil
+}
+
+// NewPCMSample returns a sample holding decoded audio. The format of p must
+// be one EncodeWAV supports.
+func NewPCMSample(name string, p *PCM) (*Sample, error) {
+	if err := p.checkFormat(); err != nil {
+		return nil, err
+	}
+	return &Sample{Name: name, pcm: p}, nil
+}
+
+// Empty reports whether the sample has no audio.
+func (s *Sample) Empty() bool {
+	return s == nil || (s.wav == nil && s.pcm == nil)
+}
+
+// PCM returns the decoded audio of the sample, or nil for an empty sample.
+// The result is shared: edit a Clone and pass it to SetPCM.
+func (s *Sample) PCM() (*PCM, error) {
+	if s.pcm == nil && s.err == nil && s.wav != nil {
+		s.pcm, s.err = DecodeWAV(s.wav)
+	}
+	return s.pcm, s.err
+}
+
+// SetPCM replaces the audio of the sample. The format of p must be one
+// EncodeWAV supports.
+func (s *Sample) SetPCM(p *PCM) error {
+	if err := p.checkFormat(); err != nil {
+		return err
+	}
+	s.wav, s.pcm, s.err = nil, p, nil
+	return nil
+}
+
+// WAV returns the sample as a WAV file, or nil for an empty sample.
+func (s *Sample) WAV() ([]byte, error) {
+	if s.wav == nil && s.pcm != nil {
+		data, err := EncodeWAV(s.pcm)
+		if err != nil {
+			return nil, err
+		}
+		s.wav = data
+	}
+	return s.wav, nil
+}
+
+// processed returns the audio of the sample once processed.
+func (s *Sample) processed() (*PCM, error) {
+	p, err := s.PCM()
+	if err != nil || p == nil || s.Processor == nil {
+		return p, err
+	}
+	return s.Processor.Process(p)
 }
@@ -0,0 +1,357 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"yrh.dev/circuit/model"
+)
+
+// projectLayout describes where the known regions of a project live. Anything
+// outside of those regions is preserved as is.
+type projectLayout struct {
+	size int
+	// header is the start of an empty project.
+	header []byte
+
+	name     int
+	settings int
+	tracks   int
+	scenes   int
+	chain    int
+	patterns int
+
+	kinds     []TrackKind
+	numScenes int
+	numSteps  int
+
+	// verified is set once the offsets have been checked against projects
+	// saved by the device.
+	verified bool
+}
+
+const (
+	// ProjectNameSize is the maximum length of a project name.
+	ProjectNameSize = 32
+
+	numScenes = 16
+)
+
+// ErrUnverifiedLayout is returned when decoding or encoding the regions of a
+// project whose layout has not been checked against device files.
+var ErrUnverifiedLayout = errors.New("project layout not verified on device files")
+
+// projectLayouts holds the layouts of each flavor. Novation doesn't document
+// the format, and apart from the Circuit Tracks size and header the offsets
+// are guesses: the Circuit size is the one the pattern layout needs. Until
+// TestDeviceProjects checks them against projects saved by the devices in
+// testdata/projects, the decoded view is disabled.
+var projectLayouts = map[*model.Flavor]*projectLayout{
+	model.Circuit: {
+		size:     25920,
+		name:     0x0010,
+		settings: 0x0030,
+		tracks:   0x0040,
+		scenes:   0x00a0,
+		chain:    0x0160,
+		patterns: 0x0180,
+		kinds: []TrackKind{
+			TrackSynth, TrackSynth,
+			TrackDrum, TrackDrum, TrackDrum, TrackDrum,
+		},
+		numScenes: numScenes,
+		numSteps:  16,
+	},
+	model.CircuitTracks: {
+		size:     160780,
+		header:   emptyProject,
+		name:     0x0010,
+		settings: 0x0030,
+		tracks:   0x0040,
+		scenes:   0x00c0,
+		chain:    0x01c0,
+		patterns: 0x0200,
+		kinds: []TrackKind{
+			TrackSynth, TrackSynth,
+			TrackMIDI, TrackMIDI,
+			TrackDrum, TrackDrum, TrackDrum, TrackDrum,
+		},
+		numScenes: numScenes,
+		numSteps:  32,
+	},
+}
+
+func layoutFor(f *model.Flavor) (*projectLayout, error) {
+	if l := projectLayouts[f]; l != nil {
+		return l, nil
+	}
+	return nil, fmt.Errorf("unsupported flavor: %s", f.Name)
+}
+
+// verifiedLayoutFor is layoutFor for the decoded view of projects.
+func verifiedLayoutFor(f *model.Flavor) (*projectLayout, error) {
+	l, err := layoutFor(f)
+	if err != nil {
+		return nil, err
+	}
+	if !l.verified {
+		return nil, fmt.Errorf("%w: %s", ErrUnverifiedLayout, f.Name)
+	}
+	return l, nil
+}
+
+type Scale byte
+
+const (
+	ScaleNaturalMinor Scale = iota
+	ScaleMajor
+	ScaleDorian
+	ScalePhrygian
+	ScaleMixolydian
+	ScaleMelodicMinor
+	ScaleHarmonicMinor
+	ScaleBebopDorian
+	ScaleBlues
+	ScaleMinorPentatonic
+	ScaleHungarianMinor
+	ScaleUkrainianDorian
+	ScaleMarva
+	ScaleTodi
+	ScaleWholeTone
+	ScaleChromatic
+)
+
+var scaleNames = []string{
+	"natural minor",
+	"major",
+	"dorian",
+	"phrygian",
+	"mixolydian",
+	"melodic minor",
+	"harmonic minor",
+	"bebop dorian",
+	"blues",
+	"minor pentatonic",
+	"hungarian minor",
+	"ukrainian dorian",
+	"marva",
+	"todi",
+	"whole tone",
+	"chromatic",
+}
+
+func (s Scale) String() string {
+	if int(s) < len(scaleNames) {
+		return scaleNames[s]
+	}
+	return fmt.Sprintf("Scale(%d)", byte(s))
+}
+
+type Key byte
+
+const (
+	KeyC Key = iota
+	KeyCSharp
+	KeyD
+	KeyDSharp
+	KeyE
+	KeyF
+	KeyFSharp
+	KeyG
+	KeyGSharp
+	KeyA
+	KeyASharp
+	KeyB
+)
+
+var keyNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+func (k Key) String() string {
+	if int(k) < len(keyNames) {
+		return keyNames[k]
+	}
+	return fmt.Sprintf("Key(%d)", byte(k))
+}
+
+// ProjectSettings holds the project-wide parameters.
+type ProjectSettings struct {
+	Tempo    byte // in BPM, 40-240
+	Swing    byte // in percent, 20-80
+	Scale    Scale
+	Key      Key
+	Reserved [12]byte
+}
+
+// TrackSettings holds the mixer and patch selection of a single track.
+type TrackSettings struct {
+	Patch      byte // synth patch or drum sample index
+	Level      byte
+	Pan        byte // 64 is center
+	ReverbSend byte
+	DelaySend  byte
+	Mute       byte
+	Reserved   [10]byte
+}
+
+// Chain is an inclusive range of patterns played in sequence.
+type Chain struct {
+	Start, End byte
+}
+
+// Scene records the pattern chain of every track.
+type Scene struct {
+	Chains []Chain
+}
+
+// Session is the decoded view of a project. Tracks are ordered as on the
+// device: synths first, then MIDI tracks (Circuit Tracks only), then drums.
+type Session struct {
+	Name       string
+	Settings   ProjectSettings
+	Tracks     []TrackSettings
+	Scenes     []Scene
+	SceneChain Chain
+}
+
+// empty returns the data of an empty project.
+func (l *projectLayout) empty() []byte {
+	data := make([]byte, l.size)
+	copy(data, l.header)
+	return data
+}
+
+// view returns the project data for reading. A project with no data reads as
+// an empty one, and is left unchanged.
+func (p *Project) view(l *projectLayout) ([]byte, error) {
+	if p.Data == nil {
+		return l.empty(), nil
+	}
+	if n := len(p.Data); n != l.size {
+		return nil, fmt.Errorf("wrong project size: want %d, got %d", l.size, n)
+	}
+	return p.Data, nil
+}
+
+// data returns the project data for writing, creating an empty project if
+// needed.
+func (p *Project) data(l *projectLayout) ([]byte, error) {
+	if p.Data == nil {
+		p.Data = l.empty()
+	}
+	return p.view(l)
+}
+
+// Session decodes the known regions of the project. It returns
+// ErrUnverifiedLayout until the layout of the flavor is verified.
+func (p *Project) Session(f *model.Flavor) (*Session, error) {
+	l, err := verifiedLayoutFor(f)
+	if err != nil {
+		return nil, err
+	}
+	return p.readSession(l)
+}
+
+func (p *Project) readSession(l *projectLayout) (*Session, error) {
+	data, err := p.view(l)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		Name:   strings.TrimRight(string(data[l.name:l.name+ProjectNameSize]), " \x00"),
+		Tracks: make([]TrackSettings, len(l.kinds)),
+		Scenes: make([]Scene, l.numScenes),
+	}
+
+	if err := binary.Read(bytes.NewReader(data[l.settings:]), binary.LittleEndian, &s.Settings); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(bytes.NewReader(data[l.tracks:]), binary.LittleEndian, s.Tracks); err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data[l.scenes:])
+	for i := range s.Scenes {
+		s.Scenes[i].Chains = make([]Chain, len(l.kinds))
+		if err := binary.Read(r, binary.LittleEndian, s.Scenes[i].Chains); err != nil {
+			return nil, err
+		}
+	}
+	if err := binary.Read(bytes.NewReader(data[l.chain:]), binary.LittleEndian, &s.SceneChain); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetSession encodes s into the project, leaving unknown regions untouched.
+// It returns ErrUnverifiedLayout until the layout of the flavor is verified.
+func (p *Project) SetSession(f *model.Flavor, s *Session) error {
+	l, err := verifiedLayoutFor(f)
+	if err != nil {
+		return err
+	}
+	return p.writeSession(l, s)
+}
+
+func (p *Project) writeSession(l *projectLayout, s *Session) error {
+	if n := len(s.Name); n > ProjectNameSize {
+		return fmt.Errorf("project name too long: %d", n)
+	}
+	if n := len(s.Tracks); n != len(l.kinds) {
+		return fmt.Errorf("wrong number of tracks: want %d, got %d", len(l.kinds), n)
+	}
+	if n := len(s.Scenes); n != l.numScenes {
+		return fmt.Errorf("wrong number of scenes: want %d, got %d", l.numScenes, n)
+	}
+	for i, scene := range s.Scenes {
+		if n := len(scene.Chains); n != len(l.kinds) {
+			return fmt.Errorf("scene %d: wrong number of chains: want %d, got %d", i, len(l.kinds), n)
+		}
+	}
+
+	data, err := p.data(l)
+	if err != nil {
+		return err
+	}
+
+	name := bytes.Repeat([]byte{0x20}, ProjectNameSize)
+	copy(name, s.Name)
+	copy(data[l.name:], name)
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, &s.Settings)
+	copy(data[l.settings:], buf.Bytes())
+
+	buf.Reset()
+	_ = binary.Write(buf, binary.LittleEndian, s.Tracks)
+	copy(data[l.tracks:], buf.Bytes())
+
+	buf.Reset()
+	for _, scene := range s.Scenes {
+		_ = binary.Write(buf, binary.LittleEndian, scene.Chains)
+	}
+	copy(data[l.scenes:], buf.Bytes())
+
+	buf.Reset()
+	_ = binary.Write(buf, binary.LittleEndian, &s.SceneChain)
+	copy(data[l.chain:], buf.Bytes())
+
+	return nil
+}
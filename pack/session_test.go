@@ -0,0 +1,160 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"yrh.dev/circuit/model"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	for _, f := range []*model.Flavor{model.Circuit, model.CircuitTracks} {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			t.Parallel()
+
+			l := projectLayouts[f]
+			p := &Project{}
+			s, err := p.readSession(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Name != "" {
+				t.Errorf("Session() name = %q, want empty", s.Name)
+			}
+
+			if p.Data != nil {
+				t.Errorf("Session() changed the project")
+			}
+
+			// Scribble over the whole project to check unknown regions are
+			// preserved.
+			p.Data = make([]byte, l.size)
+			for i := range p.Data {
+				p.Data[i] = byte(i)
+			}
+			orig := append([]byte(nil), p.Data...)
+
+			s, err = p.readSession(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.writeSession(l, s); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(orig, p.Data) {
+				t.Errorf("SetSession() altered an unmodified project")
+			}
+
+			s.Name = "My Song"
+			s.Settings.Tempo = 128
+			s.Settings.Scale = ScaleDorian
+			s.Tracks[1].Level = 100
+			s.Scenes[3].Chains[0] = Chain{Start: 2, End: 5}
+			if err := p.writeSession(l, s); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := p.readSession(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(s, got); diff != "" {
+				t.Errorf("Session() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnverifiedLayout(t *testing.T) {
+	t.Parallel()
+
+	for _, f := range []*model.Flavor{model.Circuit, model.CircuitTracks} {
+		p := &Project{}
+		if _, err := p.Session(f); !errors.Is(err, ErrUnverifiedLayout) {
+			t.Errorf("%s: Session() = %v, want %v", f.Name, err, ErrUnverifiedLayout)
+		}
+		if err := p.SetSession(f, &Session{}); !errors.Is(err, ErrUnverifiedLayout) {
+			t.Errorf("%s: SetSession() = %v, want %v", f.Name, err, ErrUnverifiedLayout)
+		}
+		if _, err := p.Pattern(f, 0, 0); !errors.Is(err, ErrUnverifiedLayout) {
+			t.Errorf("%s: Pattern() = %v, want %v", f.Name, err, ErrUnverifiedLayout)
+		}
+		pat, err := NewPattern(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SetPattern(f, 0, 0, pat); !errors.Is(err, ErrUnverifiedLayout) {
+			t.Errorf("%s: SetPattern() = %v, want %v", f.Name, err, ErrUnverifiedLayout)
+		}
+		if p.Data != nil {
+			t.Errorf("%s: writing changed the project", f.Name)
+		}
+	}
+}
+
+func TestDeviceProjects(t *testing.T) {
+	for dir, f := range map[string]*model.Flavor{
+		"circuit":        model.Circuit,
+		"circuit-tracks": model.CircuitTracks,
+	} {
+		dir, f := dir, f
+		files, err := filepath.Glob(filepath.Join("testdata", "projects", dir, "*.ncs"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(f.Name, func(t *testing.T) {
+			t.Parallel()
+
+			if len(files) == 0 {
+				t.Skipf("no %s project in testdata/projects/%s", f.Name, dir)
+			}
+			for _, fname := range files {
+				data, err := os.ReadFile(fname)
+				if err != nil {
+					t.Fatal(err)
+				}
+				p := NewProject(filepath.Base(fname), data)
+				s, err := p.readSession(projectLayouts[f])
+				if err != nil {
+					t.Errorf("%s: Session() = %v", fname, err)
+					continue
+				}
+				if tempo := s.Settings.Tempo; tempo < 40 || tempo > 240 {
+					t.Errorf("%s: tempo = %d, want 40-240", fname, tempo)
+				}
+				if int(s.Settings.Scale) >= len(scaleNames) {
+					t.Errorf("%s: invalid scale %d", fname, s.Settings.Scale)
+				}
+				for track := range TrackKinds(f) {
+					for i := 0; i < PatternsPerTrack; i++ {
+						if _, err := p.readPattern(projectLayouts[f], track, i); err != nil {
+							t.Errorf("%s: Pattern(%d, %d) = %v", fname, track, i, err)
+						}
+					}
+				}
+				if !bytes.Equal(data, p.Data) {
+					t.Errorf("%s: decoding changed the project", fname)
+				}
+			}
+		})
+	}
+}
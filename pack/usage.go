@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"fmt"
+	"time"
+
+	"yrh.dev/circuit/model"
+)
+
+// SlotUsage is the memory taken by a sample once processed and converted
+// to the device format.
+type SlotUsage struct {
+	Slot     int
+	Name     string
+	Frames   int
+	Bytes    int
+	Duration time.Duration
+	// Truncated is true when the sample is longer than the device plays. The
+	// pack still holds every frame, so Bytes counts the full length.
+	Truncated bool
+}
+
+func (u *SlotUsage) String() string {
+	s := fmt.Sprintf("slot %d (%s): %v, %d bytes", u.Slot+1, u.Name, u.Duration, u.Bytes)
+	if u.Truncated {
+		s += ", truncated"
+	}
+	return s
+}
+
+// SampleUsage reports how the samples of a pack fill the sample memory of a
+// device.
+type SampleUsage struct {
+	Flavor *model.Flavor
+	// Slots lists the non-empty sample slots.
+	Slots []*SlotUsage
+	// Bytes is the total size of the samples.
+	Bytes int
+}
+
+// Remaining returns the free sample memory in bytes. It is negative when
+// the samples don't fit, and 0 when the sample memory of the flavor is
+// unknown.
+func (u *SampleUsage) Remaining() int {
+	if u.Flavor.SampleMemory <= 0 {
+		return 0
+	}
+	return u.Flavor.SampleMemory - u.Bytes
+}
+
+// Duration converts a size of sample memory to playing time.
+func (u *SampleUsage) Duration(bytes int) time.Duration {
+	f := u.Flavor
+	frameSize := f.SampleChannels * f.SampleBitDepth / 8
+	return time.Duration(bytes/frameSize) * time.Second / time.Duration(f.SampleRate)
+}
+
+// Truncated returns the slots longer than the device plays.
+func (u *SampleUsage) Truncated() []*SlotUsage {
+	var res []*SlotUsage
+	for _, s := range u.Slots {
+		if s.Truncated {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// SampleUsage computes the sample memory used by the pack on the flavor.
+func (p *Pack) SampleUsage(f *model.Flavor) (*SampleUsage, error) {
+	if f.SampleRate <= 0 || f.SampleChannels <= 0 || f.SampleBitDepth <= 0 {
+		return nil, fmt.Errorf("%s has no sample format", f.Name)
+	}
+	u := &SampleUsage{Flavor: f}
+	for i, s := range p.Samples {
+		if s.Empty() {
+			continue
+		}
+		pcm, err := s.processed()
+		if err != nil {
+			return nil, fmt.Errorf("sample %q: %w", s.Name, err)
+		}
+		if pcm.SampleRate <= 0 {
+			return nil, fmt.Errorf("sample %q: invalid sample rate: %d", s.Name, pcm.SampleRate)
+		}
+		frames := int(int64(pcm.Frames()) * int64(f.SampleRate) / int64(pcm.SampleRate))
+		slot := &SlotUsage{
+			Slot:      i,
+			Name:      s.Name,
+			Frames:    frames,
+			Bytes:     frames * f.SampleChannels * f.SampleBitDepth / 8,
+			Duration:  time.Duration(frames) * time.Second / time.Duration(f.SampleRate),
+			Truncated: f.MaxSampleFrames > 0 && frames > f.MaxSampleFrames,
+		}
+		u.Slots = append(u.Slots, slot)
+		u.Bytes += slot.Bytes
+	}
+	return u, nil
+}
+
+// SampleMemoryError is returned when writing a pack whose samples don't fit
+// in the memory of the device.
+type SampleMemoryError struct {
+	Usage *SampleUsage
+}
+
+func (e *SampleMemoryError) Error() string {
+	u := e.Usage
+	return fmt.Sprintf("samples need %v (%d bytes) but %s only holds %v (%d bytes)",
+		u.Duration(u.Bytes), u.Bytes, u.Flavor.Name,
+		u.Duration(u.Flavor.SampleMemory), u.Flavor.SampleMemory)
+}
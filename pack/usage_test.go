@@ -0,0 +1,113 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"yrh.dev/circuit/model"
+)
+
+func TestSampleUsage(t *testing.T) {
+	t.Parallel()
+
+	f := *model.CircuitTracks
+	f.SampleMemory = 48000
+	f.MaxSampleFrames = 12000
+
+	p := &Pack{
+		Samples: []*Sample{
+			testPCMSample(t, "kick", &PCM{SampleRate: 24000, Channels: 2, BitDepth: 24, Data: make([]float64, 2*2400)}),
+			{},
+			testPCMSample(t, "pad", &PCM{SampleRate: 48000, Channels: 1, BitDepth: 16, Data: make([]float64, 14400)}),
+		},
+	}
+	u, err := p.SampleUsage(&f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*SlotUsage{
+		{Slot: 0, Name: "kick", Frames: 4800, Bytes: 9600, Duration: 100 * time.Millisecond},
+		{Slot: 2, Name: "pad", Frames: 14400, Bytes: 28800, Duration: 300 * time.Millisecond, Truncated: true},
+	}
+	if diff := cmp.Diff(want, u.Slots); diff != "" {
+		t.Errorf("SampleUsage() mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := u.Remaining(), 9600; got != want {
+		t.Errorf("Remaining() = %d, want %d", got, want)
+	}
+	if diff := cmp.Diff(want[1:], u.Truncated()); diff != "" {
+		t.Errorf("Truncated() mismatch (-want +got):\n%s", diff)
+	}
+
+	p.Samples = append(p.Samples, p.Samples[2])
+	var memErr *SampleMemoryError
+	if err := p.Write(new(bytes.Buffer), &f); !errors.As(err, &memErr) {
+		t.Fatalf("Write() = %v, want a SampleMemoryError", err)
+	}
+	if got, want := memErr.Error(), "samples need 700ms (67200 bytes) but Circuit Tracks only holds 500ms (48000 bytes)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestSampleUsageUnknownLimits(t *testing.T) {
+	t.Parallel()
+
+	p := &Pack{
+		Samples: []*Sample{
+			testPCMSample(t, "pad", &PCM{SampleRate: 48000, Channels: 1, BitDepth: 16, Data: make([]float64, 48000)}),
+		},
+	}
+	u, err := p.SampleUsage(model.CircuitTracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Remaining(); got != 0 {
+		t.Errorf("Remaining() = %d, want 0", got)
+	}
+	if got := u.Truncated(); len(got) != 0 {
+		t.Errorf("Truncated() = %v, want none", got)
+	}
+	if err := p.Write(new(bytes.Buffer), model.CircuitTracks); err != nil {
+		t.Errorf("Write() = %v", err)
+	}
+}
+
+// rateProcessor sets the sample rate without resampling.
+type rateProcessor int
+
+func (r rateProcessor) Process(p *PCM) (*PCM, error) {
+	c := p.Clone()
+	c.SampleRate = int(r)
+	return c, nil
+}
+
+func TestSampleUsageBadRate(t *testing.T) {
+	t.Parallel()
+
+	s := testPCMSample(t, "kick", &PCM{SampleRate: 48000, Channels: 1, BitDepth: 16, Data: make([]float64, 480)})
+	s.Processor = rateProcessor(0)
+	p := &Pack{Samples: []*Sample{s}}
+	if _, err := p.SampleUsage(model.CircuitTracks); err == nil {
+		t.Error("SampleUsage() succeeded, want error")
+	}
+	if err := p.Write(new(bytes.Buffer), model.CircuitTracks); err == nil {
+		t.Error("Write() succeeded, want error")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"fmt"
+	"strings"
+
+	"yrh.dev/circuit/model"
+)
+
+// ValidationError lists every illegal value found in a patch.
+type ValidationError struct {
+	Errors []*RangeError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid patch: %s", strings.Join(msgs, "; "))
+}
+
+// Name characters must be printable ASCII.
+const (
+	minNameChar = 0x20
+	maxNameChar = 0x7e
+)
+
+// Validate checks every parameter of the patch against its legal range. Both
+// flavors share the same synth engine, hence the same ranges: the flavor is
+// only checked to be one with patches. It returns a *ValidationError listing
+// the illegal values.
+func (p *Patch) Validate(f *model.Flavor) error {
+	if f == nil {
+		return ErrUnknownFlavor
+	}
+	supported := false
+	for _, m := range patchFlavors {
+		supported = supported || m == f
+	}
+	if !supported {
+		return fmt.Errorf("%w: %s", ErrUnknownFlavor, f.Name)
+	}
+
+	verr := &ValidationError{}
+	for i, c := range p.PatchName {
+		if c < minNameChar || c > maxNameChar {
+			verr.Errors = append(verr.Errors, &RangeError{
+				Path:  fmt.Sprintf("PatchName[%d]", i),
+				Value: c,
+			})
+		}
+	}
+	for _, param := range params {
+		if v := byte(param.field(p).Uint()); !param.Valid(v) {
+			verr.Errors = append(verr.Errors, &RangeError{Path: param.Path, Value: v})
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
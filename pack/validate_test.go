@@ -0,0 +1,72 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"yrh.dev/circuit/model"
+)
+
+func validPatch(t *testing.T) *Patch {
+	t.Helper()
+
+	p := &Patch{}
+	copy(p.PatchName[:], "Valid           ")
+	for _, param := range Params() {
+		if err := p.Set(param.Path, param.Min); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func TestValidate(t *testing.T) {
+	p := validPatch(t)
+	if err := p.Validate(model.CircuitTracks); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+
+	p.PatchName[15] = 0
+	p.Filter.Type = 6
+	p.ModMatrix[4].Destination = 18
+
+	err := p.Validate(model.Circuit)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate() = %v, want ValidationError", err)
+	}
+	want := []*RangeError{
+		{Path: "PatchName[15]", Value: 0},
+		{Path: "Filter.Type", Value: 6},
+		{Path: "ModMatrix[4].Destination", Value: 18},
+	}
+	if diff := cmp.Diff(want, verr.Errors); diff != "" {
+		t.Errorf("Validate() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidateFlavor(t *testing.T) {
+	t.Parallel()
+
+	p := validPatch(t)
+	for _, f := range []*model.Flavor{nil, {Name: "Launchpad"}} {
+		if err := p.Validate(f); !errors.Is(err, ErrUnknownFlavor) {
+			t.Errorf("Validate(%v) = %v, want %v", f, err, ErrUnknownFlavor)
+		}
+	}
+}
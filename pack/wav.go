@@ -0,0 +1,343 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+	"github.com/orcaman/writerseeker"
+	"yrh.dev/circuit/model"
+)
+
+// WAVE format tags. Extensible files carry the actual tag at the start of
+// their subformat GUID.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+// wavFormat returns the format tag of a WAV file, resolving extensible
+// formats.
+func wavFormat(data []byte) (uint16, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, errors.New("invalid WAV: not a RIFF WAVE file")
+	}
+	for off := 12; off+8 <= len(data); {
+		id := string(data[off : off+4])
+		size := int(binary.LittleEndian.Uint32(data[off+4 : off+8]))
+		body := data[off+8:]
+		if size > len(body) {
+			break
+		}
+		body = body[:size]
+		if id == "fmt " {
+			if len(body) < 2 {
+				break
+			}
+			tag := binary.LittleEndian.Uint16(body)
+			if tag == wavFormatExtensible {
+				if len(body) < 26 {
+					break
+				}
+				tag = binary.LittleEndian.Uint16(body[24:])
+			}
+			return tag, nil
+		}
+		off += 8 + size + size%2
+	}
+	return 0, errors.New("invalid WAV: bad format chunk")
+}
+
+// DecodeWAV decodes a WAV file holding integer or 32-bit float samples.
+func DecodeWAV(data []byte) (*PCM, error) {
+	format, err := wavFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	if format != wavFormatPCM && format != wavFormatFloat {
+		return nil, fmt.Errorf("unsupported WAV: format %#x", format)
+	}
+
+	d := wav.NewDecoder(bytes.NewReader(data))
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		return nil, err
+	}
+	if d.NumChans == 0 {
+		return nil, errors.New("invalid WAV: no channels")
+	}
+
+	p := &PCM{
+		SampleRate: int(d.SampleRate),
+		Channels:   int(d.NumChans),
+		BitDepth:   int(d.BitDepth),
+		Float:      format == wavFormatFloat,
+		Data:       make([]float64, len(buf.Data)),
+	}
+	if err := p.checkFormat(); err != nil {
+		return nil, err
+	}
+	if p.Float {
+		for i, v := range buf.Data {
+			p.Data[i] = clip(float64(math.Float32frombits(uint32(v))))
+		}
+	} else {
+		p.setInts(buf.Data)
+	}
+	return p, nil
+}
+
+// EncodeWAV encodes p as a WAV file.
+func EncodeWAV(p *PCM) ([]byte, error) {
+	if err := p.checkFormat(); err != nil {
+		return nil, err
+	}
+	format := wavFormatPCM
+	var data []int
+	if p.Float {
+		format = wavFormatFloat
+		data = make([]int, len(p.Data))
+		for i, v := range p.Data {
+			data[i] = int(int32(math.Float32bits(float32(v))))
+		}
+	} else {
+		data = p.ints()
+	}
+
+	w := &writerseeker.WriterSeeker{}
+	e := wav.NewEncoder(w, p.SampleRate, p.BitDepth, p.Channels, format)
+	buf := &audio.IntBuffer{
+		Format:         &audio.Format{NumChannels: p.Channels, SampleRate: p.SampleRate},
+		Data:           data,
+		SourceBitDepth: p.BitDepth,
+	}
+	if err := e.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(w.Reader())
+}
+
+// checkFormat reports an error if p cannot be encoded as a WAV file: integer
+// samples have 8, 16, 24 or 32 bits, and float samples 32 bits.
+func (p *PCM) checkFormat() error {
+	switch {
+	case p.SampleRate <= 0:
+		return fmt.Errorf("invalid sample rate: %d", p.SampleRate)
+	case p.Channels <= 0:
+		return fmt.Errorf("invalid number of channels: %d", p.Channels)
+	case p.Float && p.BitDepth != 32:
+		return fmt.Errorf("unsupported WAV: %d-bit float", p.BitDepth)
+	}
+	switch p.BitDepth {
+	case 8, 16, 24, 32:
+		return nil
+	}
+	return fmt.Errorf("unsupported WAV: %d-bit", p.BitDepth)
+}
+
+// Integer samples are scaled by a power of two so that conversions are
+// lossless. 8-bit samples are unsigned.
+func (p *PCM) scale() float64 {
+	return float64(int64(1) << (p.BitDepth - 1))
+}
+
+func (p *PCM) setInts(data []int) {
+	scale := p.scale()
+	p.Data = make([]float64, len(data))
+	for i, v := range data {
+		if p.BitDepth == 8 {
+			v -= 128
+		}
+		p.Data[i] = float64(v) / scale
+	}
+}
+
+func (p *PCM) ints() []int {
+	scale := p.scale()
+	data := make([]int, len(p.Data))
+	for i, v := range p.Data {
+		x := math.Round(clip(v) * scale)
+		if x > scale-1 {
+			x = scale - 1
+		}
+		data[i] = int(x)
+		if p.BitDepth == 8 {
+			data[i] += 128
+		}
+	}
+	return data
+}
+
+func clip(v float64) float64 {
+	switch {
+	case v > 1:
+		return 1
+	case v < -1:
+		return -1
+	case math.IsNaN(v):
+		return 0
+	}
+	return v
+}
+
+// downmix averages all channels into a single one.
+func (p *PCM) downmix() {
+	if p.Channels == 1 {
+		return
+	}
+	mono := make([]float64, p.Frames())
+	for i := range mono {
+		var sum float64
+		for _, v := range p.Data[i*p.Channels : (i+1)*p.Channels] {
+			sum += v
+		}
+		mono[i] = sum / float64(p.Channels)
+	}
+	p.Channels = 1
+	p.Data = mono
+}
+
+// resample changes the sample rate using linear interpolation. When the rate
+// drops, frequencies above the new Nyquist frequency are filtered out first so
+// they do not fold back as aliases.
+func (p *PCM) resample(rate int) {
+	if p.SampleRate == rate {
+		return
+	}
+	if rate < p.SampleRate {
+		p.lowpass(0.5 * float64(rate) / float64(p.SampleRate))
+	}
+	n := p.Frames()
+	m := int(int64(n) * int64(rate) / int64(p.SampleRate))
+	out := make([]float64, m*p.Channels)
+	for i := 0; i < m; i++ {
+		pos := float64(i) * float64(p.SampleRate) / float64(rate)
+		j := int(pos)
+		frac := pos - float64(j)
+		for c := 0; c < p.Channels; c++ {
+			a := p.Data[j*p.Channels+c]
+			b := a
+			if j+1 < n {
+				b = p.Data[(j+1)*p.Channels+c]
+			}
+			out[i*p.Channels+c] = a + (b-a)*frac
+		}
+	}
+	p.SampleRate = rate
+	p.Data = out
+}
+
+// lowpassZeros is the number of zero crossings of the sinc on each side of
+// the lowpass kernel.
+const lowpassZeros = 8
+
+// lowpass filters out frequencies above cutoff, a fraction of the sample
+// rate, with a Blackman-windowed sinc.
+func (p *PCM) lowpass(cutoff float64) {
+	half := int(math.Ceil(lowpassZeros / (2 * cutoff)))
+	kernel := make([]float64, 2*half+1)
+	var sum float64
+	for i := range kernel {
+		x := float64(i - half)
+		v := 2 * cutoff
+		if x != 0 {
+			v = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		w := 2 * math.Pi * float64(i) / float64(len(kernel)-1)
+		v *= 0.42 - 0.5*math.Cos(w) + 0.08*math.Cos(2*w)
+		kernel[i] = v
+		sum += v
+	}
+
+	n := p.Frames()
+	out := make([]float64, len(p.Data))
+	for i := 0; i < n; i++ {
+		for c := 0; c < p.Channels; c++ {
+			var v float64
+			for k, coef := range kernel {
+				if j := i + k - half; j >= 0 && j < n {
+					v += coef * p.Data[j*p.Channels+c]
+				}
+			}
+			out[i*p.Channels+c] = v / sum
+		}
+	}
+	p.Data = out
+}
+
+// matches reports whether p is already in the format expected by the flavor.
+func (p *PCM) matches(f *model.Flavor) bool {
+	return !p.Float && p.SampleRate == f.SampleRate && p.BitDepth == f.SampleBitDepth && p.Channels == f.SampleChannels
+}
+
+// conform returns p converted to the format expected by the flavor.
+func (p *PCM) conform(f *model.Flavor) (*PCM, error) {
+	if err := p.checkFormat(); err != nil {
+		return nil, err
+	}
+	if p.matches(f) {
+		return p, nil
+	}
+	c := p.Clone()
+	if c.Channels != f.SampleChannels {
+		if f.SampleChannels != 1 {
+			return nil, fmt.Errorf("cannot convert %d channels to %d", c.Channels, f.SampleChannels)
+		}
+		c.downmix()
+	}
+	c.resample(f.SampleRate)
+	c.BitDepth = f.SampleBitDepth
+	c.Float = false
+	return c, nil
+}
+
+// devicePCM returns the processed audio of the sample in the format
+// expected by the flavor.
+func (s *Sample) devicePCM(f *model.Flavor) (*PCM, error) {
+	p, err := s.processed()
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return p.conform(f)
+}
+
+// deviceWAV returns the processed sample as a WAV file in the format
+// expected by the flavor. Unprocessed files already in that format are
+// returned unchanged.
+func (s *Sample) deviceWAV(f *model.Flavor) ([]byte, error) {
+	p, err := s.processed()
+	if err != nil || p == nil {
+		return nil, err
+	}
+	if s.Processor == nil && p.matches(f) {
+		return s.WAV()
+	}
+	c, err := p.conform(f)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWAV(c)
+}
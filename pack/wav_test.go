@@ -0,0 +1,311 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+	"github.com/google/go-cmp/cmp"
+	"github.com/orcaman/writerseeker"
+	"yrh.dev/circuit/model"
+)
+
+func encodeTestWAV(t *testing.T, rate, bits, channels, format int, data []int) []byte {
+	t.Helper()
+
+	w := &writerseeker.WriterSeeker{}
+	e := wav.NewEncoder(w, rate, bits, channels, format)
+	buf := &audio.IntBuffer{
+		Format:         &audio.Format{NumChannels: channels, SampleRate: rate},
+		Data:           data,
+		SourceBitDepth: bits,
+	}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(w.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestDeviceWAV(t *testing.T) {
+	t.Parallel()
+
+	f := model.CircuitTracks
+	float := func(v ...float32) []int {
+		var res []int
+		for _, x := range v {
+			res = append(res, int(int32(math.Float32bits(x))))
+		}
+		return res
+	}
+
+	for _, tc := range []struct {
+		name string
+		in   []byte
+		want []int
+	}{
+		{
+			name: "24-bit stereo",
+			in:   encodeTestWAV(t, 48000, 24, 2, wavFormatPCM, []int{0x400000, 0, -0x200000, -0x200000}),
+			want: []int{8192, -8192},
+		},
+		{
+			name: "8-bit",
+			in:   encodeTestWAV(t, 48000, 8, 1, wavFormatPCM, []int{128, 192, 64}),
+			want: []int{0, 16384, -16384},
+		},
+		{
+			name: "float",
+			in:   encodeTestWAV(t, 48000, 32, 1, wavFormatFloat, float(0, 0.5, -2)),
+			want: []int{0, 16384, -32768},
+		},
+		{
+			name: "24kHz",
+			in:   encodeTestWAV(t, 24000, 16, 1, wavFormatPCM, []int{0, 1000}),
+			want: []int{0, 500, 1000, 1000},
+		},
+	} {
+		out, err := NewSample("", tc.in).deviceWAV(f)
+		if err != nil {
+			t.Errorf("%s: deviceWAV() = %v", tc.name, err)
+			continue
+		}
+		d := wav.NewDecoder(bytes.NewReader(out))
+		buf, err := d.FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		format := []int{int(d.SampleRate), int(d.BitDepth), int(d.NumChans)}
+		if diff := cmp.Diff([]int{48000, 16, 1}, format); diff != "" {
+			t.Errorf("%s: format mismatch (-want +got):\n%s", tc.name, diff)
+		}
+		if diff := cmp.Diff(tc.want, buf.Data); diff != "" {
+			t.Errorf("%s: data mismatch (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestDeviceWAVUnchanged(t *testing.T) {
+	t.Parallel()
+
+	in := encodeTestWAV(t, 48000, 16, 1, wavFormatPCM, []int{1, 2, 3})
+	out, err := NewSample("", in).deviceWAV(model.CircuitTracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(in, out) {
+		t.Error("deviceWAV() changed a WAV already in the device format")
+	}
+}
+
+func TestResampleAntiAlias(t *testing.T) {
+	t.Parallel()
+
+	sine := func(freq float64) *PCM {
+		p := &PCM{SampleRate: 96000, Channels: 1, BitDepth: 16, Data: make([]float64, 9600)}
+		for i := range p.Data {
+			p.Data[i] = math.Sin(2 * math.Pi * freq * float64(i) / 96000)
+		}
+		return p
+	}
+	rms := func(p *PCM) float64 {
+		var sum float64
+		data := p.Data[100 : len(p.Data)-100]
+		for _, v := range data {
+			sum += v * v
+		}
+		return math.Sqrt(sum / float64(len(data)))
+	}
+
+	for _, tc := range []struct {
+		freq     float64
+		min, max float64
+	}{
+		{freq: 1000, min: 0.69, max: 0.72},
+		{freq: 30000, min: 0, max: 0.01},
+	} {
+		p := sine(tc.freq)
+		p.resample(48000)
+		if got := rms(p); got < tc.min || got > tc.max {
+			t.Errorf("resample() of %v Hz: RMS = %.3f, want %.3f-%.3f", tc.freq, got, tc.min, tc.max)
+		}
+	}
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, bits := range []int{8, 16, 24, 32} {
+		scale := 1 << (bits - 1)
+		data := []int{0, 1, -1, scale - 1, -scale}
+		if bits == 8 {
+			data = []int{128, 129, 127, 255, 0}
+		}
+		p, err := DecodeWAV(encodeTestWAV(t, 44100, bits, 2, wavFormatPCM, append(data, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := p.Frames(), 3; got != want {
+			t.Errorf("%d bits: Frames() = %d, want %d", bits, got, want)
+		}
+		enc, err := EncodeWAV(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := DecodeWAV(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(p, q); diff != "" {
+			t.Errorf("%d bits: round trip mismatch (-want +got):\n%s", bits, diff)
+		}
+		if diff := cmp.Diff(append(data, 0), q.ints()); diff != "" {
+			t.Errorf("%d bits: ints mismatch (-want +got):\n%s", bits, diff)
+		}
+	}
+}
+
+// extensibleWAV rewrites the format chunk of a WAV file from encodeTestWAV
+// as WAVE_FORMAT_EXTENSIBLE with the given subformat tag.
+func extensibleWAV(in []byte, sub uint16) []byte {
+	fmtChunk := in[20:36]
+	ext := make([]byte, 40)
+	copy(ext, fmtChunk)
+	binary.LittleEndian.PutUint16(ext[0:], wavFormatExtensible)
+	binary.LittleEndian.PutUint16(ext[16:], 22)
+	copy(ext[18:], fmtChunk[14:16])
+	binary.LittleEndian.PutUint16(ext[24:], sub)
+	copy(ext[26:], "\x00\x00\x00\x00\x10\x00\x80\x00\x00\xaa\x00\x38\x9b\x71")
+
+	out := append([]byte{}, in[:12]...)
+	out = append(out, "fmt \x28\x00\x00\x00"...)
+	out = append(out, ext...)
+	out = append(out, in[36:]...)
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out
+}
+
+func TestDecodeWAVFormats(t *testing.T) {
+	t.Parallel()
+
+	pcm := encodeTestWAV(t, 48000, 16, 1, wavFormatPCM, []int{1, -1})
+	float := encodeTestWAV(t, 48000, 32, 1, wavFormatFloat, []int{int(int32(math.Float32bits(0.5)))})
+	for _, tc := range []struct {
+		name  string
+		in    []byte
+		want  []float64
+		float bool
+	}{
+		{name: "PCM", in: pcm, want: []float64{1.0 / 32768, -1.0 / 32768}},
+		{name: "float", in: float, want: []float64{0.5}, float: true},
+		{name: "extensible PCM", in: extensibleWAV(pcm, wavFormatPCM), want: []float64{1.0 / 32768, -1.0 / 32768}},
+		{name: "extensible float", in: extensibleWAV(float, wavFormatFloat), want: []float64{0.5}, float: true},
+		{name: "A-law", in: encodeTestWAV(t, 48000, 8, 1, 6, []int{1, 2})},
+		{name: "mu-law", in: encodeTestWAV(t, 48000, 8, 1, 7, []int{1, 2})},
+		{name: "extensible A-law", in: extensibleWAV(encodeTestWAV(t, 48000, 16, 1, 6, []int{1, 2}), 6)},
+		{name: "extensible bad chunk", in: extensibleWAV(pcm, wavFormatPCM)[:40]},
+		{name: "not RIFF", in: []byte("RIFX\x04\x00\x00\x00WAVE")},
+	} {
+		p, err := DecodeWAV(tc.in)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("%s: DecodeWAV() succeeded, want error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: DecodeWAV() = %v", tc.name, err)
+			continue
+		}
+		if p.Float != tc.float {
+			t.Errorf("%s: Float = %v, want %v", tc.name, p.Float, tc.float)
+		}
+		if diff := cmp.Diff(tc.want, p.Data); diff != "" {
+			t.Errorf("%s: data mismatch (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestPCMBadFormat(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []*PCM{
+		{SampleRate: 48000, Channels: 1, BitDepth: 0},
+		{SampleRate: 48000, Channels: 1, BitDepth: 12},
+		{SampleRate: 48000, Channels: 1, BitDepth: 64},
+		{SampleRate: 48000, Channels: 1, BitDepth: 16, Float: true},
+		{SampleRate: 0, Channels: 1, BitDepth: 16},
+		{SampleRate: 48000, Channels: 0, BitDepth: 16},
+	} {
+		p.Data = make([]float64, 4)
+		if _, err := EncodeWAV(p); err == nil {
+			t.Errorf("EncodeWAV(%+v) succeeded, want error", *p)
+		}
+		if _, err := NewPCMSample("bad", p); err == nil {
+			t.Errorf("NewPCMSample(%+v) succeeded, want error", *p)
+		}
+		if err := (&Sample{}).SetPCM(p); err == nil {
+			t.Errorf("SetPCM(%+v) succeeded, want error", *p)
+		}
+	}
+}
+
+func TestSampleRepeatableAccess(t *testing.T) {
+	t.Parallel()
+
+	s, err := ReadSample("kick", bytes.NewReader(encodeTestWAV(t, 48000, 16, 1, wavFormatPCM, []int{1, 2})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Pack{Samples: []*Sample{s}}
+	var packs [2]bytes.Buffer
+	for i := range packs {
+		if err := p.Write(&packs[i], model.CircuitTracks); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(packs[0].Bytes(), packs[1].Bytes()) {
+		t.Error("writing a pack twice gave different results")
+	}
+
+	pcm, err := s.PCM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit := pcm.Clone()
+	edit.Data[0] = 0.5
+	if err := s.SetPCM(edit); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.PCM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Data[0] != 0.5 || pcm.Data[0] == 0.5 {
+		t.Errorf("SetPCM() data = %v, original = %v", got.Data, pcm.Data)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sample
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"yrh.dev/circuit/model"
+	"yrh.dev/circuit/pack"
+)
+
+// OnsetOptions configures the detection of the start of a sound.
+type OnsetOptions struct {
+	// Threshold is the level, in dBFS, below which audio is silent.
+	Threshold float64
+	// Rise is the increase in level, in dB, from one analysis window to the
+	// next that marks a transient.
+	Rise float64
+	// Window is the length of the analysis windows.
+	Window time.Duration
+	// PreRoll is the audio kept before the detected start.
+	PreRoll time.Duration
+}
+
+// DefaultOnsetOptions suits drum one-shots.
+var DefaultOnsetOptions = OnsetOptions{
+	Threshold: -48,
+	Rise:      12,
+	Window:    time.Millisecond,
+	PreRoll:   time.Millisecond,
+}
+
+func durationFrames(p *pack.PCM, d time.Duration) int {
+	return int(int64(d) * int64(p.SampleRate) / int64(time.Second))
+}
+
+// Onset returns the first frame of the first transient of the audio. For
+// sounds fading in without a transient, it returns the first frame above the
+// threshold. It returns -1 for silent audio.
+func Onset(p *pack.PCM, o OnsetOptions) int {
+	n := p.Frames()
+	size := durationFrames(p, o.Window)
+	if size < 1 {
+		size = 1
+	}
+	floor := Level(o.Threshold)
+	floor *= floor
+	ratio := Level(o.Rise)
+	ratio *= ratio
+
+	prev := floor
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		var energy float64
+		for _, v := range p.Data[start*p.Channels : end*p.Channels] {
+			energy += v * v
+		}
+		energy /= float64((end - start) * p.Channels)
+
+		if energy >= floor && energy >= prev*ratio {
+			return firstAbove(p, start, end, o.Threshold)
+		}
+		prev = math.Max(energy, floor)
+	}
+	return firstAbove(p, 0, n, o.Threshold)
+}
+
+// firstAbove returns the first frame from start up to end at or above
+// threshold, in dBFS, or -1.
+func firstAbove(p *pack.PCM, start, end int, threshold float64) int {
+	lvl := Level(threshold)
+	for i := start; i < end; i++ {
+		if framePeak(p, i) >= lvl {
+			return i
+		}
+	}
+	return -1
+}
+
+// TrimToOnset cuts the audio before its onset, keeping the pre-roll, and
+// removes trailing silence. Silent audio is left unchanged.
+func TrimToOnset(o OnsetOptions) Op {
+	return func(p *pack.PCM) (*pack.PCM, error) {
+		onset := Onset(p, o)
+		if onset < 0 {
+			return p, nil
+		}
+		start := onset - durationFrames(p, o.PreRoll)
+		if start < 0 {
+			start = 0
+		}
+		end := p.Frames()
+		lvl := Level(o.Threshold)
+		for end > onset && framePeak(p, end-1) < lvl {
+			end--
+		}
+		return Trim(start, end)(p)
+	}
+}
+
+// Process returns an operation running a processor.
+func Process(pr pack.Processor) Op {
+	return pr.Process
+}
+
+// TrimReport compares the sample memory used by a pack before and after
+// trimming.
+type TrimReport struct {
+	Before, After *pack.SampleUsage
+}
+
+// Saved returns the sample memory saved, in bytes.
+func (r *TrimReport) Saved() int {
+	return r.Before.Bytes - r.After.Bytes
+}
+
+func (r *TrimReport) String() string {
+	f := r.After.Flavor
+	s := fmt.Sprintf("saved %v (%d bytes): %v", r.After.Duration(r.Saved()), r.Saved(), r.After.Duration(r.After.Bytes))
+	if f.SampleMemory <= 0 {
+		return s + " used"
+	}
+	return fmt.Sprintf("%s of %v used, %v left", s,
+		r.After.Duration(f.SampleMemory), r.After.Duration(r.After.Remaining()))
+}
+
+// onsetTrim runs a processor, then trims the result to its onset.
+type onsetTrim struct {
+	pr pack.Processor
+	o  OnsetOptions
+}
+
+func (t *onsetTrim) Process(p *pack.PCM) (*pack.PCM, error) {
+	if t.pr != nil {
+		var err error
+		if p, err = t.pr.Process(p); err != nil {
+			return nil, err
+		}
+	}
+	return TrimToOnset(t.o)(p)
+}
+
+// AutoTrim trims every sample of the pack to its onset by appending
+// TrimToOnset to its processor, and reports the memory saved on the flavor.
+// Running it again replaces the trim rather than adding another one. The
+// pack is left unchanged on error.
+func AutoTrim(p *pack.Pack, f *model.Flavor, o OnsetOptions) (*TrimReport, error) {
+	before, err := p.SampleUsage(f)
+	if err != nil {
+		return nil, err
+	}
+	procs := make([]pack.Processor, len(p.Samples))
+	trimmed := &pack.Pack{Samples: make([]*pack.Sample, len(p.Samples))}
+	for i, s := range p.Samples {
+		trimmed.Samples[i] = s
+		if s.Empty() {
+			continue
+		}
+		pr := s.Processor
+		if t, ok := pr.(*onsetTrim); ok {
+			pr = t.pr
+		}
+		procs[i] = &onsetTrim{pr: pr, o: o}
+		c := *s
+		c.Processor = procs[i]
+		trimmed.Samples[i] = &c
+	}
+	after, err := trimmed.SampleUsage(f)
+	if err != nil {
+		return nil, err
+	}
+	for i, s := range p.Samples {
+		if procs[i] != nil {
+			s.Processor = procs[i]
+		}
+	}
+	return &TrimReport{Before: before, After: after}, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sample
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"yrh.dev/circuit/model"
+	"yrh.dev/circuit/pack"
+)
+
+// oneShot returns a mono hit preceded by lead frames of low noise and
+// followed by tail frames of silence.
+func oneShot(lead, hit, tail int) *pack.PCM {
+	p := &pack.PCM{SampleRate: 48000, Channels: 1, BitDepth: 16}
+	for i := 0; i < lead; i++ {
+		p.Data = append(p.Data, 0.001*math.Sin(float64(i)))
+	}
+	for i := 0; i < hit; i++ {
+		p.Data = append(p.Data, 0.8*math.Exp(-float64(i)/200)*math.Cos(float64(i)/5))
+	}
+	p.Data = append(p.Data, make([]float64, tail)...)
+	return p
+}
+
+func TestOnset(t *testing.T) {
+	t.Parallel()
+
+	swell := &pack.PCM{SampleRate: 48000, Channels: 1, BitDepth: 16}
+	for i := 0; i < 4800; i++ {
+		swell.Data = append(swell.Data, 0.5*float64(i)/4800)
+	}
+
+	for _, tc := range []struct {
+		name string
+		in   *pack.PCM
+		want int
+	}{
+		{name: "hit", in: oneShot(4800, 2400, 0), want: 4800},
+		{name: "unaligned hit", in: oneShot(1000, 2400, 0), want: 1000},
+		{name: "swell", in: swell, want: 39},
+		{name: "silence", in: oneShot(4800, 0, 0), want: -1},
+	} {
+		if got := Onset(tc.in, DefaultOnsetOptions); got != tc.want {
+			t.Errorf("%s: Onset() = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTrimToOnset(t *testing.T) {
+	t.Parallel()
+
+	in := oneShot(4800, 2400, 4800)
+	got, err := TrimToOnset(DefaultOnsetOptions)(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1ms of pre-roll, and the tail of the hit below the threshold.
+	if got.Frames() < 48+1000 || got.Frames() > 48+2400 {
+		t.Errorf("Frames() = %d, want between %d and %d", got.Frames(), 48+1000, 48+2400)
+	}
+	if got.Data[48] != in.Data[4800] {
+		t.Errorf("trimmed audio doesn't start on the hit")
+	}
+
+	silent := oneShot(100, 0, 0)
+	if got, _ := TrimToOnset(DefaultOnsetOptions)(silent); got != silent {
+		t.Errorf("TrimToOnset() changed silent audio")
+	}
+}
+
+func TestAutoTrim(t *testing.T) {
+	t.Parallel()
+
+	p := &pack.Pack{
+		Samples: []*pack.Sample{
+			pcmSample(t, "kick", oneShot(9600, 2400, 0)),
+			{},
+			pcmSample(t, "snare", oneShot(4800, 2400, 0)),
+		},
+	}
+	p.Samples[2].Processor = Chain(Gain(-6))
+
+	r, err := AutoTrim(p, model.CircuitTracks, DefaultOnsetOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// At least the leading noise, less the pre-roll, at 2 bytes per frame.
+	if want := 2 * (9600 + 4800 - 2*48); r.Saved() < want {
+		t.Errorf("Saved() = %d, want at least %d", r.Saved(), want)
+	}
+	if got := r.After.Remaining(); got != 0 {
+		t.Errorf("Remaining() = %d, want 0 with an unknown sample memory", got)
+	}
+	if s := r.String(); !strings.HasPrefix(s, "saved 3") || strings.Contains(s, "left") {
+		t.Errorf("String() = %q, want a saving over 300ms and no memory left", s)
+	}
+
+	pcm, err := p.Samples[0].PCM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := pcm.Duration(), 250*time.Millisecond; got != want {
+		t.Errorf("AutoTrim() changed the sample audio: duration %v, want %v", got, want)
+	}
+	if got, want := len(p.Samples[2].Processor.(*onsetTrim).pr.(Pipeline)), 1; got != want {
+		t.Errorf("AutoTrim() wrapped a %d-op pipeline, want %d", got, want)
+	}
+
+	r, err = AutoTrim(p, model.CircuitTracks, DefaultOnsetOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Saved() != 0 {
+		t.Errorf("second AutoTrim() saved %d bytes, want 0", r.Saved())
+	}
+	if _, ok := p.Samples[2].Processor.(*onsetTrim).pr.(Pipeline); !ok {
+		t.Errorf("second AutoTrim() stacked trims: processor %T", p.Samples[2].Processor.(*onsetTrim).pr)
+	}
+}
+
+// failOnce fails the second time it runs.
+type failOnce struct {
+	runs int
+}
+
+func (f *failOnce) Process(p *pack.PCM) (*pack.PCM, error) {
+	if f.runs++; f.runs > 1 {
+		return nil, errors.New("failed")
+	}
+	return p, nil
+}
+
+func TestAutoTrimError(t *testing.T) {
+	t.Parallel()
+
+	pr := &failOnce{}
+	p := &pack.Pack{
+		Samples: []*pack.Sample{
+			pcmSample(t, "kick", oneShot(9600, 2400, 0)),
+			pcmSample(t, "snare", oneShot(4800, 2400, 0)),
+		},
+	}
+	p.Samples[1].Processor = pr
+
+	if _, err := AutoTrim(p, model.CircuitTracks, DefaultOnsetOptions); err == nil {
+		t.Fatal("AutoTrim() succeeded, want error")
+	}
+	if p.Samples[0].Processor != nil || p.Samples[1].Processor != pr {
+		t.Errorf("AutoTrim() changed processors on error: %T, %T", p.Samples[0].Processor, p.Samples[1].Processor)
+	}
+}
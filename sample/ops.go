@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sample
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"yrh.dev/circuit/pack"
+)
+
+// Trim keeps the frames from start up to end, excluded. An end past the
+// last frame is clamped.
+func Trim(start, end int) Op {
+	return func(p *pack.PCM) (*pack.PCM, error) {
+		last := end
+		if n := p.Frames(); last > n {
+			last = n
+		}
+		if start < 0 || start > last {
+			return nil, fmt.Errorf("invalid trim range: %d-%d", start, end)
+		}
+		return withData(p, append([]float64(nil), p.Data[start*p.Channels:last*p.Channels]...)), nil
+	}
+}
+
+// TrimSilence removes the leading and trailing frames quieter than
+// threshold, in dBFS. Audio entirely below the threshold becomes empty.
+func TrimSilence(threshold float64) Op {
+	return func(p *pack.PCM) (*pack.PCM, error) {
+		lvl := Level(threshold)
+		n := p.Frames()
+		start := 0
+		for start < n && framePeak(p, start) < lvl {
+			start++
+		}
+		end := n
+		for end > start && framePeak(p, end-1) < lvl {
+			end--
+		}
+		return Trim(start, end)(p)
+	}
+}
+
+func fade(d time.Duration, in bool) Op {
+	return func(p *pack.PCM) (*pack.PCM, error) {
+		n := p.Frames()
+		size := int(int64(d) * int64(p.SampleRate) / int64(time.Second))
+		if size > n {
+			size = n
+		}
+		data := append([]float64(nil), p.Data...)
+		for i := 0; i < size; i++ {
+			frame, gain := i, float64(i)/float64(size)
+			if !in {
+				frame = n - 1 - i
+			}
+			for c := 0; c < p.Channels; c++ {
+				data[frame*p.Channels+c] *= gain
+			}
+		}
+		return withData(p, data), nil
+	}
+}
+
+// FadeIn ramps the level up from silence over d.
+func FadeIn(d time.Duration) Op {
+	return fade(d, true)
+}
+
+// FadeOut ramps the level down to silence over the last d.
+func FadeOut(d time.Duration) Op {
+	return fade(d, false)
+}
+
+// Gain changes the level by db. Values beyond full scale are clipped when
+// the audio is encoded.
+func Gain(db float64) Op {
+	return func(p *pack.PCM) (*pack.PCM, error) {
+		return scale(p, Level(db)), nil
+	}
+}
+
+func scale(p *pack.PCM, gain float64) *pack.PCM {
+	data := make([]float64, len(p.Data))
+	for i, v := range p.Data {
+		data[i] = v * gain
+	}
+	return withData(p, data)
+}
+
+// NormalizePeak scales the audio so that its peak is at level, in dBFS.
+// Silent audio is left unchanged.
+func NormalizePeak(level float64) Op {
+	return func(p *pack.PCM) (*pack.PCM, error) {
+		var peak float64
+		for _, v := range p.Data {
+			peak = math.Max(peak, math.Abs(v))
+		}
+		if peak == 0 {
+			return p, nil
+		}
+		return scale(p, Level(level)/peak), nil
+	}
+}
+
+// NormalizeRMS scales the audio so that its RMS level is level, in dBFS.
+// Silent audio is left unchanged.
+func NormalizeRMS(level float64) Op {
+	return func(p *pack.PCM) (*pack.PCM, error) {
+		rms := RMS(p)
+		if rms == 0 {
+			return p, nil
+		}
+		return scale(p, Level(level)/rms), nil
+	}
+}
+
+// RMS returns the root mean square of the audio as a linear amplitude.
+func RMS(p *pack.PCM) float64 {
+	if len(p.Data) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range p.Data {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(p.Data)))
+}
+
+// Reverse plays the audio backwards.
+func Reverse() Op {
+	return func(p *pack.PCM) (*pack.PCM, error) {
+		n := p.Frames()
+		data := make([]float64, len(p.Data))
+		for i := 0; i < n; i++ {
+			copy(data[(n-1-i)*p.Channels:(n-i)*p.Channels], p.Data[i*p.Channels:(i+1)*p.Channels])
+		}
+		return withData(p, data), nil
+	}
+}
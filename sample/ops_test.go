@@ -0,0 +1,117 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sample
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"yrh.dev/circuit/model"
+	"yrh.dev/circuit/pack"
+)
+
+func stereo(data ...float64) *pack.PCM {
+	return &pack.PCM{SampleRate: 1000, Channels: 2, BitDepth: 16, Data: data}
+}
+
+func pcmSample(t *testing.T, name string, p *pack.PCM) *pack.Sample {
+	t.Helper()
+	s, err := pack.NewPCMSample(name, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOps(t *testing.T) {
+	t.Parallel()
+
+	in := stereo(0, 0, 0.001, 0, 0.5, -0.25, -0.1, 0.2, 0, 0.0001)
+	orig := in.Clone()
+
+	for _, tc := range []struct {
+		name string
+		op   Op
+		want []float64
+	}{
+		{name: "trim", op: Trim(1, 3), want: []float64{0.001, 0, 0.5, -0.25}},
+		{name: "trim past end", op: Trim(4, 10), want: []float64{0, 0.0001}},
+		{name: "trim silence", op: TrimSilence(-40), want: []float64{0.5, -0.25, -0.1, 0.2}},
+		{name: "fade in", op: FadeIn(2 * time.Millisecond), want: []float64{0, 0, 0.0005, 0, 0.5, -0.25, -0.1, 0.2, 0, 0.0001}},
+		{name: "fade out", op: FadeOut(2 * time.Millisecond), want: []float64{0, 0, 0.001, 0, 0.5, -0.25, -0.05, 0.1, 0, 0}},
+		{name: "gain", op: Gain(6.020599913279624), want: []float64{0, 0, 0.002, 0, 1, -0.5, -0.2, 0.4, 0, 0.0002}},
+		{name: "peak", op: NormalizePeak(0), want: []float64{0, 0, 0.002, 0, 1, -0.5, -0.2, 0.4, 0, 0.0002}},
+		{name: "reverse", op: Reverse(), want: []float64{0, 0.0001, -0.1, 0.2, 0.5, -0.25, 0.001, 0, 0, 0}},
+	} {
+		got, err := tc.op(in)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, got.Data, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+			t.Errorf("%s: mismatch (-want +got):\n%s", tc.name, diff)
+		}
+	}
+	if diff := cmp.Diff(orig, in); diff != "" {
+		t.Errorf("ops modified their input (-want +got):\n%s", diff)
+	}
+
+	if _, err := Trim(3, 1)(in); err == nil {
+		t.Error("Trim(3, 1) succeeded, want error")
+	}
+}
+
+func TestNormalizeRMS(t *testing.T) {
+	t.Parallel()
+
+	got, err := NormalizeRMS(-6)(stereo(0.1, -0.1, 0.1, -0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rms, want := RMS(got), Level(-6); !cmp.Equal(rms, want, cmpopts.EquateApprox(0, 1e-9)) {
+		t.Errorf("RMS() = %v, want %v", rms, want)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	t.Parallel()
+
+	pcm := &pack.PCM{SampleRate: 48000, Channels: 1, BitDepth: 16, Data: []float64{0, 0, 0.25, 0.5, 0}}
+	s := pcmSample(t, "kick", pcm)
+	s.Processor = Chain(TrimSilence(-60), NormalizePeak(0), Reverse())
+
+	p := &pack.Pack{Samples: []*pack.Sample{s}}
+	buf := new(bytes.Buffer)
+	if err := p.Write(buf, model.CircuitTracks); err != nil {
+		t.Fatal(err)
+	}
+	out := &pack.Pack{}
+	if err := out.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := out.Samples[0].PCM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]float64{1 - 1.0/32768, 0.5}, got.Data); diff != "" {
+		t.Errorf("written sample mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]float64{0, 0, 0.25, 0.5, 0}, pcm.Data); diff != "" {
+		t.Errorf("pipeline modified the sample (-want +got):\n%s", diff)
+	}
+}
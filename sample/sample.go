@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sample edits the decoded audio of pack samples.
+//
+// Operations never modify their input. They can be chained in a Pipeline,
+// which is applied when a pack is written once set as the Processor of a
+// pack.Sample. AutoTrim uses them to make one-shots start on their first
+// transient, saving sample memory.
+package sample
+
+import (
+	"math"
+
+	"yrh.dev/circuit/pack"
+)
+
+// Op is an audio operation.
+type Op func(p *pack.PCM) (*pack.PCM, error)
+
+// Pipeline applies operations in order.
+type Pipeline []Op
+
+// Chain returns a pipeline of the operations.
+func Chain(ops ...Op) Pipeline {
+	return Pipeline(ops)
+}
+
+// Process implements pack.Processor.
+func (pl Pipeline) Process(p *pack.PCM) (*pack.PCM, error) {
+	for _, op := range pl {
+		var err error
+		if p, err = op(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Level converts a level in dBFS to a linear amplitude.
+func Level(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// withData returns a copy of p holding data.
+func withData(p *pack.PCM, data []float64) *pack.PCM {
+	c := *p
+	c.Data = data
+	return &c
+}
+
+// framePeak returns the largest absolute value of the channels of frame i.
+func framePeak(p *pack.PCM, i int) float64 {
+	var peak float64
+	for _, v := range p.Data[i*p.Channels : (i+1)*p.Channels] {
+		peak = math.Max(peak, math.Abs(v))
+	}
+	return peak
+}